@@ -20,11 +20,37 @@ provider "dokku" {
 
   # The SSH key should be that of a dokku user. Dokku users have dokku set as a
   # forced command - the provider will not attempt to explicitly specify the
-  # dokku binary over SSH.
+  # dokku binary over SSH. To connect as another user with passwordless sudo
+  # access to dokku, set use_sudo (or a custom command_prefix) instead.
   #
   # This can be an absolute path OR just contain the SSH key inline.
   ssh_cert = "/home/user/dokku-vagrant"
   #ssh_passphrase = "optional"
+
+  # Keys held by a running ssh-agent can be used instead of (or as well as)
+  # ssh_cert, along with an OpenSSH user certificate signed by your CA.
+  #ssh_agent            = true
+  #ssh_user_certificate = "/home/user/dokku-vagrant-cert.pub"
+
+  # By default the host key is checked against (and added to) ~/.ssh/known_hosts.
+  # Pinning it instead means it's verified strictly and nothing is written to
+  # disk, which is useful on ephemeral CI runners & Terraform Cloud.
+  #host_key_fingerprint = "SHA256:..."
+
+  # When terraform runs on the Dokku server itself, dokku can be run directly
+  # rather than over SSH.
+  #transport = "local"
+
+  #use_sudo = true
+
+  # If the Dokku host can only be reached via a bastion/jump host, the
+  # connection can be tunnelled through it. The bastion uses the key above
+  # unless one is provided here.
+  #bastion {
+  #  ssh_host = "bastion.example.com"
+  #  ssh_user = "ubuntu"
+  #  ssh_cert = "/home/user/bastion-key"
+  #}
 }
 
 # Creates a dokku app
@@ -49,6 +75,13 @@ resource "dokku_app" "rails-app" {
     "https://github.com/heroku/heroku-buildpack-ruby.git"
   ]
 
+  # The builder to use, and builder specific settings. By default dokku picks
+  # a builder based on the app's source
+  # https://dokku.com/docs/deployment/builders/builder-management/
+  #builder         = "dockerfile"
+  #build_dir       = "apps/api"
+  #dockerfile_path = "Dockerfile.prod"
+
   # Additional host -> container port mappings
   # https://dokku.com/docs/networking/port-management/
   #ports = ["tcp:25:25"]
@@ -59,8 +92,103 @@ resource "dokku_app" "rails-app" {
   # https://dokku.com/docs/configuration/nginx/#binding-to-specific-addresses
   #nginx_bind_address_ipv4 = "192.168.5.5"
   #nginx_bind_address_ipv6 = "2345:0425:2CA1:0000:0000:0567:5673:23b5"
+
+  # The proxy the app uses, defaults to the host's global proxy type. The nginx
+  # settings below only apply to apps using nginx
+  # https://dokku.com/docs/networking/proxy-management/
+  #proxy_type    = "caddy"
+  #proxy_enabled = true
+
+  # Other nginx properties
+  # https://dokku.com/docs/networking/proxies/nginx/
+  #nginx = {
+  #  client-max-body-size = "50m"
+  #  proxy-read-timeout   = "120s"
+  #}
+
+  # A custom nginx.conf.sigil template in the app's repository, or in the
+  # source_path of a dokku_app_deploy. Dokku can't upload one on its own.
+  # https://dokku.com/docs/networking/proxies/nginx/#customizing-the-nginx-configuration
+  #nginx_conf_sigil_path = "config/nginx.conf.sigil"
+
+  # Number of processes to run for each process type in the app's Procfile
+  # https://dokku.com/docs/processes/process-management/#scaling-apps
+  #process_scale = {
+  #  web    = 2
+  #  worker = 1
+  #}
+
+  # Zero downtime deploy checks
+  # https://dokku.com/docs/deployment/zero-downtime-deploys/
+  #checks {
+  #  skipped        = ["worker"]
+  #  wait_to_retire = 300
+  #}
+
+  # Options passed to docker when building, deploying & running the app
+  # https://dokku.com/docs/advanced-usage/docker-options/
+  #docker_options {
+  #  deploy = ["--log-driver json-file"]
+  #  run    = ["--cap-add=SYS_PTRACE"]
+  #}
+
+  # Sync (and deploy) the app's code from a git repository
+  # https://dokku.com/docs/deployment/methods/git/#syncing-code-from-remote-repositories
+  #git_sync {
+  #  remote = "https://github.com/dokku/smoke-test-app.git"
+  #  ref    = "v1.0.0"
+  #}
+
+  # Resource limits & reservations, per process type
+  # https://dokku.com/docs/advanced-usage/resource-management/
+  #resources {
+  #  process_type = "web"
+  #  limit {
+  #    cpu    = "1"
+  #    memory = "512m"
+  #  }
+  #  reserve {
+  #    memory = "256m"
+  #  }
+  #}
+}
+
+# Persistent storage for the app, mounted on its next deploy
+# https://dokku.com/docs/advanced-usage/persistent-storage/
+resource "dokku_app_storage" "rails-app-uploads" {
+  app            = dokku_app.rails-app.name
+  name           = "rails-app-uploads"
+  chown          = "herokuish"
+  container_path = "/app/public/uploads"
 }
 
+# A Let's Encrypt certificate for the app's domains. Requires the letsencrypt
+# plugin https://github.com/dokku/dokku-letsencrypt
+#resource "dokku_letsencrypt" "rails-app" {
+#  app     = dokku_app.rails-app.name
+#  email   = "admin@dokku.me"
+#  domains = dokku_app.rails-app.domains
+#}
+
+# Or, a certificate issued elsewhere
+#resource "dokku_app_certificate" "rails-app" {
+#  app         = dokku_app.rails-app.name
+#  certificate = file("wildcard.crt")
+#  private_key = file("wildcard.key")
+#}
+
+# Deploy an image built elsewhere, e.g by CI
+#resource "dokku_app_deploy" "rails-app" {
+#  app   = dokku_app.rails-app.name
+#  image = "registry.example.com/rails-app@sha256:..."
+#}
+
+# Or, the app's source built on the machine running terraform
+#resource "dokku_app_deploy" "rails-app" {
+#  app         = dokku_app.rails-app.name
+#  source_path = "${path.module}/build"
+#}
+
 # Below are examples of the creation of services & how to link them to the 
 # app created above. This is dependent on the necessary dokku plugins being
 # installed.
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/blang/semver"
+)
+
+// Logical operations whose command differs between dokku versions
+type dokkuOp string
+
+const (
+	opPortsAdd    dokkuOp = "ports-add"
+	opPortsRemove dokkuOp = "ports-remove"
+	opPortsList   dokkuOp = "ports-list"
+
+	opBuilderNixpacksReport dokkuOp = "builder-nixpacks-report"
+	opBuilderNixpacksSet    dokkuOp = "builder-nixpacks-set"
+)
+
+// A command used from one dokku version up to, but not including, another
+type versionedCommand struct {
+	from  semver.Version
+	until semver.Version
+	cmd   string
+}
+
+func (c versionedCommand) matches(version semver.Version) bool {
+	return version.GTE(c.from) && version.LT(c.until)
+}
+
+// The commands to use for each operation, by dokku version. Entries are checked
+// in order, with the last one being the current syntax - which is also what's
+// used for hosts outside of every range (i.e untested versions). An empty
+// command means the operation isn't available in those versions.
+//
+// Together the entries cover the versions this provider is tested against (see
+// testedDokkuVersions), so supporting a new release means bumping the until of
+// the current entries, and adding entries for any commands that changed in it.
+//
+// Operations not listed here use the same command across every tested version,
+// so resources use them directly.
+var dokkuCommands = map[dokkuOp][]versionedCommand{
+	// proxy:ports* were deprecated in favour of ports:* in 0.32
+	opPortsAdd: {
+		{semver.MustParse("0.30.0"), semver.MustParse("0.32.0"), "proxy:ports-add"},
+		{semver.MustParse("0.32.0"), semver.MustParse("0.36.0"), "ports:add"},
+	},
+	opPortsRemove: {
+		{semver.MustParse("0.30.0"), semver.MustParse("0.32.0"), "proxy:ports-remove"},
+		{semver.MustParse("0.32.0"), semver.MustParse("0.36.0"), "ports:remove"},
+	},
+	opPortsList: {
+		{semver.MustParse("0.30.0"), semver.MustParse("0.32.0"), "proxy:ports"},
+		{semver.MustParse("0.32.0"), semver.MustParse("0.36.0"), "ports:list"},
+	},
+	// The nixpacks builder was added in 0.33
+	opBuilderNixpacksReport: {
+		{semver.MustParse("0.30.0"), semver.MustParse("0.33.0"), ""},
+		{semver.MustParse("0.33.0"), semver.MustParse("0.36.0"), "builder-nixpacks:report"},
+	},
+	opBuilderNixpacksSet: {
+		{semver.MustParse("0.30.0"), semver.MustParse("0.33.0"), ""},
+		{semver.MustParse("0.33.0"), semver.MustParse("0.36.0"), "builder-nixpacks:set"},
+	},
+}
+
+// The range of dokku versions this provider is tested against, from the
+// earliest to the latest version in dokkuCommands
+func testedDokkuVersions() string {
+	var from, until semver.Version
+
+	first := true
+	for _, commands := range dokkuCommands {
+		for _, c := range commands {
+			if first || c.from.LT(from) {
+				from = c.from
+			}
+			if first || c.until.GT(until) {
+				until = c.until
+			}
+			first = false
+		}
+	}
+
+	return fmt.Sprintf(">=%s <%s", from, until)
+}
+
+// Look up the command for the operation on the given version of dokku
+func commandForVersion(op dokkuOp, version semver.Version) (string, error) {
+	commands, ok := dokkuCommands[op]
+	if !ok || len(commands) == 0 {
+		return "", fmt.Errorf("no command registered for %s", op)
+	}
+
+	for _, c := range commands {
+		if c.matches(version) {
+			return c.cmd, nil
+		}
+	}
+
+	return commands[len(commands)-1].cmd, nil
+}
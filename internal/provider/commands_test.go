@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func TestCommandForVersion(t *testing.T) {
+	// An operation with a gap between its ranges, to check what versions
+	// outside every range get
+	const opGapped dokkuOp = "test-gapped"
+	dokkuCommands[opGapped] = []versionedCommand{
+		{semver.MustParse("0.30.0"), semver.MustParse("0.31.0"), "old:command"},
+		{semver.MustParse("0.32.0"), semver.MustParse("0.36.0"), "new:command"},
+	}
+	t.Cleanup(func() { delete(dokkuCommands, opGapped) })
+
+	cases := []struct {
+		op       dokkuOp
+		version  string
+		expected string
+	}{
+		{opPortsAdd, "0.30.0", "proxy:ports-add"},
+		{opPortsAdd, "0.31.9", "proxy:ports-add"},
+		{opPortsAdd, "0.32.0", "ports:add"},
+		{opPortsAdd, "0.35.12", "ports:add"},
+		{opPortsRemove, "0.31.9", "proxy:ports-remove"},
+		{opPortsRemove, "0.32.0", "ports:remove"},
+		{opPortsList, "0.31.9", "proxy:ports"},
+		{opPortsList, "0.32.0", "ports:list"},
+		{opBuilderNixpacksReport, "0.32.0", ""},
+		{opBuilderNixpacksReport, "0.33.0", "builder-nixpacks:report"},
+		{opBuilderNixpacksSet, "0.32.0", ""},
+		{opBuilderNixpacksSet, "0.33.0", "builder-nixpacks:set"},
+		{opGapped, "0.30.5", "old:command"},
+		{opGapped, "0.33.0", "new:command"},
+		// Outside every range, the current syntax is used
+		{opGapped, "0.29.0", "new:command"},
+		{opGapped, "0.31.5", "new:command"},
+		{opGapped, "1.0.0", "new:command"},
+	}
+
+	for _, c := range cases {
+		cmd, err := commandForVersion(c.op, semver.MustParse(c.version))
+		if err != nil {
+			t.Errorf("looking up %s on %s failed: %v", c.op, c.version, err)
+		}
+		if cmd != c.expected {
+			t.Errorf("expected %s on %s to be %s, got %s", c.op, c.version, c.expected, cmd)
+		}
+	}
+}
+
+func TestTestedDokkuVersions(t *testing.T) {
+	tested := testedDokkuVersions()
+	if tested != ">=0.30.0 <0.36.0" {
+		t.Errorf("unexpected tested versions %s", tested)
+	}
+
+	// Every operation should have a command for each tested version, so that
+	// none fall back to the current syntax by mistake
+	for op, commands := range dokkuCommands {
+		if tested != fmt.Sprintf(">=%s <%s", commands[0].from, commands[len(commands)-1].until) {
+			t.Errorf("expected %s to cover %s", op, tested)
+		}
+		for i := 1; i < len(commands); i++ {
+			if !commands[i].from.Equals(commands[i-1].until) {
+				t.Errorf("expected %s's commands to be contiguous, %s follows %s", op, commands[i].from, commands[i-1].until)
+			}
+		}
+	}
+}
+
+func TestCommandForVersionUnregistered(t *testing.T) {
+	if _, err := commandForVersion("test-unregistered", semver.MustParse("0.35.0")); err == nil {
+		t.Errorf("expected an error for an operation without any commands")
+	}
+}
+
+func TestDokkuClientSupports(t *testing.T) {
+	client := NewDokkuClient(nil, semver.MustParse("0.32.0"))
+	if client.Supports(opBuilderNixpacksSet) {
+		t.Errorf("expected %s not to be supported on %s", opBuilderNixpacksSet, client.Version)
+	}
+	if client.Supports("test-unregistered") {
+		t.Errorf("expected an operation without any commands not to be supported")
+	}
+
+	client.Version = semver.MustParse("0.33.0")
+	if !client.Supports(opBuilderNixpacksSet) {
+		t.Errorf("expected %s to be supported on %s", opBuilderNixpacksSet, client.Version)
+	}
+}
@@ -1,12 +1,16 @@
 package provider
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 
 	"al.essio.dev/pkg/shellescape"
 )
@@ -19,10 +23,152 @@ type DokkuApp struct {
 	ConfigVars map[string]string
 	Domains    []string
 	Buildpacks []string
+	// builder attribute (e.g build_dir) -> value, for the properties in
+	// dokkuBuilderProperties which are set
+	Builder map[string]string
 	// slice of strings denoting schema:hostPort:containerPort
-	Ports                []string
+	Ports []string
+	// the proxy the app uses (e.g nginx or caddy), and whether it's enabled
+	ProxyType            string
+	ProxyEnabled         bool
 	NginxBindAddressIpv4 string
 	NginxBindAddressIpv6 string
+	// nginx property (e.g client-max-body-size) -> value, for the properties
+	// in dokkuNginxProperties which are set
+	Nginx map[string]string
+	// the path of the app's nginx.conf.sigil template, relative to the root of
+	// its repository
+	NginxConfSigilPath string
+	// the app's rendered nginx.conf, empty until the app is deployed
+	NginxConfig string
+	// process type -> number of processes
+	ProcessScale map[string]int
+	// process type -> resource limits & reservations
+	Resources map[string]*DokkuAppResources
+	// phase (build/deploy/run) -> options
+	DockerOptions map[string][]string
+	// nil unless the app is synced from a git repository
+	GitSync *DokkuAppGitSync
+	// nil when not managed by terraform
+	Checks *DokkuAppChecks
+	// the sha of the app's last deploy, from git:report
+	GitSha string
+}
+
+// The zero downtime deploy checks for the app's process types. Process types
+// not disabled or skipped have checks enabled.
+type DokkuAppChecks struct {
+	// process types, or _all_ for all of them
+	Disabled []string
+	Skipped  []string
+	// checks:set wait-to-retire, in seconds, with 0 meaning dokku's default
+	WaitToRetire int
+}
+
+// A git repository, and the ref in it, to sync the app's code from
+type DokkuAppGitSync struct {
+	Remote string
+	Ref    string
+	// whether to build (i.e deploy) the app once synced
+	Build bool
+}
+
+// The nginx properties that can be set with the nginx attribute. Bind addresses
+// have their own attributes.
+var dokkuNginxProperties = []string{
+	"access-log-format",
+	"access-log-path",
+	"client-max-body-size",
+	"disable-custom-config",
+	"error-log-path",
+	"hsts",
+	"hsts-include-subdomains",
+	"hsts-max-age",
+	"hsts-preload",
+	"proxy-buffer-size",
+	"proxy-buffering",
+	"proxy-buffers",
+	"proxy-busy-buffers-size",
+	"proxy-read-timeout",
+	"x-forwarded-for-value",
+	"x-forwarded-port-value",
+	"x-forwarded-proto-value",
+	"x-forwarded-ssl",
+}
+
+// The proxy implementations dokku ships with, which can be set with proxy:set
+var dokkuProxyTypes = []string{"caddy", "haproxy", "nginx", "openresty", "traefik"}
+
+// The nginx properties, config & template only apply to apps using the nginx
+// proxy. Dokku versions that don't report the proxy type only support nginx.
+func (app *DokkuApp) usesNginx() bool {
+	return app.ProxyType == "" || app.ProxyType == "nginx"
+}
+
+// The phases docker options can be set for
+var dokkuDockerOptionPhases = []string{"build", "deploy", "run"}
+
+// The process type dokku applies resources to when no process type is given,
+// which is used for any process type without its own
+const defaultProcessType = "_default_"
+
+// The builders dokku can build apps with, which can be selected with builder:set
+var dokkuBuilders = []string{"dockerfile", "herokuish", "lambda", "nixpacks", "pack", "railpack"}
+
+// A property of the builder plugin, or of a specific builder's plugin (e.g
+// builder-dockerfile), with the attribute used for it
+type dokkuBuilderProperty struct {
+	attribute string
+	plugin    string
+	property  string
+	// the plugin's report & set operations in dokkuCommands, for plugins that
+	// only some versions of dokku have
+	reportOp dokkuOp
+	setOp    dokkuOp
+}
+
+var dokkuBuilderProperties = []dokkuBuilderProperty{
+	{"builder", "builder", "selected", "", ""},
+	{"build_dir", "builder", "build-dir", "", ""},
+	{"dockerfile_path", "builder-dockerfile", "dockerfile-path", "", ""},
+	{"projecttoml_path", "builder-pack", "projecttoml-path", "", ""},
+	{"nixpackstoml_path", "builder-nixpacks", "nixpackstoml-path", opBuilderNixpacksReport, opBuilderNixpacksSet},
+}
+
+// Whether the host's version of dokku has the plugin
+func (p dokkuBuilderProperty) supported(client *DokkuClient, op dokkuOp) bool {
+	return op == "" || client.Supports(op)
+}
+
+// The plugin's report or set command on the host's version of dokku
+func (p dokkuBuilderProperty) command(client *DokkuClient, op dokkuOp, subcommand string) (string, error) {
+	if op != "" {
+		return client.Cmd(op)
+	}
+	return p.plugin + ":" + subcommand, nil
+}
+
+// The property's key in the plugin's report, e.g "Builder dockerfile
+// dockerfile path" for builder-dockerfile's dockerfile-path
+func (p dokkuBuilderProperty) reportKey() string {
+	plugin := strings.ReplaceAll(p.plugin, "-", " ")
+	return strings.ToUpper(plugin[:1]) + plugin[1:] + " " + strings.ReplaceAll(p.property, "-", " ")
+}
+
+// The resources that can be limited and reserved, as named by
+// resource:limit/resource:reserve flags, with the attribute names used for them
+var dokkuResourceTypes = map[string]string{
+	"cpu":         "cpu",
+	"memory":      "memory",
+	"memory-swap": "memory_swap",
+	"nvidia-gpu":  "nvidia_gpu",
+}
+
+type DokkuAppResources struct {
+	ProcessType string
+	// resource type (e.g memory-swap) -> value, for each
+	Limit   map[string]string
+	Reserve map[string]string
 }
 
 //
@@ -39,6 +185,10 @@ func (app *DokkuApp) setOnResourceData(d *schema.ResourceData) {
 		d.Set("buildpacks", app.Buildpacks)
 	}
 
+	for _, property := range dokkuBuilderProperties {
+		d.Set(property.attribute, app.Builder[property.attribute])
+	}
+
 	managedPorts := app.managedPorts(d)
 	if len(managedPorts) > 0 {
 		d.Set("ports", managedPorts)
@@ -46,8 +196,39 @@ func (app *DokkuApp) setOnResourceData(d *schema.ResourceData) {
 		d.Set("ports", nil)
 	}
 
-	d.Set("nginx_bind_address_ipv4", app.NginxBindAddressIpv4)
-	d.Set("nginx_bind_address_ipv6", app.NginxBindAddressIpv6)
+	// Leave alone a proxy type set outside of terraform
+	if _, ok := d.GetOk("proxy_type"); ok {
+		d.Set("proxy_type", app.ProxyType)
+	}
+	d.Set("proxy_enabled", app.ProxyEnabled)
+
+	// The nginx settings aren't read for apps using another proxy, so are
+	// left as configured
+	if app.usesNginx() {
+		d.Set("nginx_bind_address_ipv4", app.NginxBindAddressIpv4)
+		d.Set("nginx_bind_address_ipv6", app.NginxBindAddressIpv6)
+		d.Set("nginx", app.managedNginx(d))
+
+		// Leave alone a template path set outside of terraform
+		if _, ok := d.GetOk("nginx_conf_sigil_path"); ok {
+			d.Set("nginx_conf_sigil_path", app.NginxConfSigilPath)
+		}
+	}
+	d.Set("nginx_config", app.NginxConfig)
+
+	d.Set("process_scale", app.managedProcessScale(d))
+
+	d.Set("resources", app.managedResources(d))
+
+	d.Set("docker_options", app.managedDockerOptions(d))
+
+	d.Set("git_sha", app.GitSha)
+
+	if checksFromResourceData(d) != nil && app.Checks != nil {
+		d.Set("checks", []interface{}{app.Checks.toResourceData()})
+	} else {
+		d.Set("checks", nil)
+	}
 }
 
 // Leave alone config vars that are set outside of terraform. This is one way
@@ -95,6 +276,176 @@ func (app *DokkuApp) managedPorts(d *schema.ResourceData) []string {
 	return tfPorts
 }
 
+// Leave alone nginx properties set outside of terraform, like config vars
+func (app *DokkuApp) managedNginx(d *schema.ResourceData) map[string]string {
+	tfNginx := make(map[string]string)
+
+	if c, ok := d.GetOk("nginx"); ok {
+		for property := range c.(map[string]interface{}) {
+			if value, ok := app.Nginx[property]; ok {
+				tfNginx[property] = value
+			}
+		}
+	}
+
+	return tfNginx
+}
+
+// Process types not in the config are left alone too, e.g those scaled by hand
+// or from the app's app.json
+func (app *DokkuApp) managedProcessScale(d *schema.ResourceData) map[string]int {
+	tfScale := make(map[string]int)
+
+	if c, ok := d.GetOk("process_scale"); ok {
+		for procType := range c.(map[string]interface{}) {
+			if count, ok := app.ProcessScale[procType]; ok {
+				tfScale[procType] = count
+			}
+		}
+	}
+
+	return tfScale
+}
+
+// As with ports, dokku sets some docker options itself (e.g --restart on
+// deploy) as do other plugins (e.g storage mounts), so only those in the config
+// are kept
+func (app *DokkuApp) managedDockerOptions(d *schema.ResourceData) []interface{} {
+	tfOptions := dockerOptionsFromResourceData(d)
+	if tfOptions == nil {
+		return []interface{}{}
+	}
+
+	managed := make(map[string]interface{})
+
+	for _, phase := range dokkuDockerOptionPhases {
+		tfLookup := sliceToLookupMap(tfOptions[phase])
+		phaseOptions := []interface{}{}
+
+		for _, option := range app.DockerOptions[phase] {
+			if _, ok := tfLookup[option]; ok {
+				phaseOptions = append(phaseOptions, option)
+			}
+		}
+
+		managed[phase] = phaseOptions
+	}
+
+	return []interface{}{managed}
+}
+
+// nil if there's no docker_options block
+func dockerOptionsFromList(blocks []interface{}) map[string][]string {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	options := make(map[string][]string)
+
+	if blocks[0] == nil {
+		return options
+	}
+
+	block := blocks[0].(map[string]interface{})
+	for _, phase := range dokkuDockerOptionPhases {
+		if set, ok := block[phase].(*schema.Set); ok {
+			options[phase] = interfaceSliceToStrSlice(set.List())
+		}
+	}
+
+	return options
+}
+
+func dockerOptionsFromResourceData(d *schema.ResourceData) map[string][]string {
+	return dockerOptionsFromList(d.Get("docker_options").([]interface{}))
+}
+
+// Resources are only read for the process types in the config, to match what
+// resource:limit-clear etc are run for
+func (app *DokkuApp) managedResources(d *schema.ResourceData) []interface{} {
+	managed := []interface{}{}
+
+	for _, r := range resourcesFromResourceData(d) {
+		resources, ok := app.Resources[r.ProcessType]
+		if !ok {
+			continue
+		}
+
+		m := map[string]interface{}{
+			"process_type": resources.ProcessType,
+			"limit":        []interface{}{},
+			"reserve":      []interface{}{},
+		}
+
+		if values := resourceValuesToResourceData(resources.Limit); values != nil {
+			m["limit"] = []interface{}{values}
+		}
+		if values := resourceValuesToResourceData(resources.Reserve); values != nil {
+			m["reserve"] = []interface{}{values}
+		}
+
+		managed = append(managed, m)
+	}
+
+	return managed
+}
+
+// nil if no values are set, so that no block is shown for them
+func resourceValuesToResourceData(values map[string]string) map[string]interface{} {
+	m := make(map[string]interface{})
+	isSet := false
+
+	for resourceType, attr := range dokkuResourceTypes {
+		m[attr] = values[resourceType]
+		if values[resourceType] != "" {
+			isSet = true
+		}
+	}
+
+	if !isSet {
+		return nil
+	}
+	return m
+}
+
+func resourceValuesFromResourceData(blocks []interface{}) map[string]string {
+	values := make(map[string]string)
+
+	if len(blocks) == 0 || blocks[0] == nil {
+		return values
+	}
+
+	block := blocks[0].(map[string]interface{})
+	for resourceType, attr := range dokkuResourceTypes {
+		if v, ok := block[attr].(string); ok && v != "" {
+			values[resourceType] = v
+		}
+	}
+
+	return values
+}
+
+func resourcesFromSet(set *schema.Set) map[string]*DokkuAppResources {
+	resources := make(map[string]*DokkuAppResources)
+
+	for _, r := range set.List() {
+		block := r.(map[string]interface{})
+		procType := block["process_type"].(string)
+
+		resources[procType] = &DokkuAppResources{
+			ProcessType: procType,
+			Limit:       resourceValuesFromResourceData(block["limit"].([]interface{})),
+			Reserve:     resourceValuesFromResourceData(block["reserve"].([]interface{})),
+		}
+	}
+
+	return resources
+}
+
+func resourcesFromResourceData(d *schema.ResourceData) map[string]*DokkuAppResources {
+	return resourcesFromSet(d.Get("resources").(*schema.Set))
+}
+
 func (app *DokkuApp) configVarsStr() string {
 	str := ""
 	for k, v := range app.ConfigVars {
@@ -117,278 +468,995 @@ func NewDokkuAppFromResourceData(d *schema.ResourceData) *DokkuApp {
 		configVars[ck] = cv.(string)
 	}
 
+	processScale := make(map[string]int)
+	for procType, count := range d.Get("process_scale").(map[string]interface{}) {
+		processScale[procType] = count.(int)
+	}
+
+	nginx := mapOfInterfacesToMapOfStrings(d.Get("nginx").(map[string]interface{}))
+
+	// The proxy is left as it is unless proxy_enabled is set, which GetOk
+	// can't tell apart from it being false
+	proxyEnabled := true
+	if enabled, ok := d.GetOkExists("proxy_enabled"); ok {
+		proxyEnabled = enabled.(bool)
+	}
+
+	builder := make(map[string]string)
+	for _, property := range dokkuBuilderProperties {
+		if value := d.Get(property.attribute).(string); value != "" {
+			builder[property.attribute] = value
+		}
+	}
+
 	return &DokkuApp{
 		Name:                 d.Get("name").(string),
 		Locked:               d.Get("locked").(bool),
 		ConfigVars:           configVars,
 		Domains:              domains,
 		Buildpacks:           buildpacks,
+		Builder:              builder,
 		Ports:                ports,
+		ProxyType:            d.Get("proxy_type").(string),
+		ProxyEnabled:         proxyEnabled,
 		NginxBindAddressIpv4: d.Get("nginx_bind_address_ipv4").(string),
 		NginxBindAddressIpv6: d.Get("nginx_bind_address_ipv6").(string),
+		Nginx:                nginx,
+		NginxConfSigilPath:   d.Get("nginx_conf_sigil_path").(string),
+		ProcessScale:         processScale,
+		Resources:            resourcesFromResourceData(d),
+		DockerOptions:        dockerOptionsFromResourceData(d),
+		GitSync:              gitSyncFromResourceData(d),
+		Checks:               checksFromResourceData(d),
 	}
 }
 
-//
-func dokkuAppRetrieve(appName string, client *goph.Client) (*DokkuApp, error) {
-	res := run(client, fmt.Sprintf("apps:exists %s", appName))
+func (checks *DokkuAppChecks) toResourceData() map[string]interface{} {
+	return map[string]interface{}{
+		"disabled":       checks.Disabled,
+		"skipped":        checks.Skipped,
+		"wait_to_retire": checks.WaitToRetire,
+	}
+}
+
+func checksFromList(blocks []interface{}) *DokkuAppChecks {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	checks := &DokkuAppChecks{Disabled: []string{}, Skipped: []string{}}
+
+	if blocks[0] == nil {
+		return checks
+	}
+
+	block := blocks[0].(map[string]interface{})
+	checks.Disabled = interfaceSliceToStrSlice(block["disabled"].(*schema.Set).List())
+	checks.Skipped = interfaceSliceToStrSlice(block["skipped"].(*schema.Set).List())
+	checks.WaitToRetire = block["wait_to_retire"].(int)
+
+	return checks
+}
+
+func checksFromResourceData(d *schema.ResourceData) *DokkuAppChecks {
+	return checksFromList(d.Get("checks").([]interface{}))
+}
+
+func gitSyncFromResourceData(d *schema.ResourceData) *DokkuAppGitSync {
+	blocks := d.Get("git_sync").([]interface{})
+	if len(blocks) == 0 || blocks[0] == nil {
+		return nil
+	}
+
+	block := blocks[0].(map[string]interface{})
+
+	return &DokkuAppGitSync{
+		Remote: block["remote"].(string),
+		Ref:    block["ref"].(string),
+		Build:  block["build"].(bool),
+	}
+}
+
+// Read the app from dokku. Reads that only some configs need (builder, checks,
+// process scale etc) each run a command over SSH, so are skipped unless their
+// attribute is set in d's config or state.
+func dokkuAppRetrieve(ctx context.Context, appName string, client *DokkuClient, d *schema.ResourceData) (*DokkuApp, error) {
+	res := run(ctx, client, fmt.Sprintf("apps:exists %s", appName))
 
-	app := &DokkuApp{Id: appName, Name: appName, Locked: false}
+	app := &DokkuApp{Id: appName, Name: appName}
 
 	if res.err != nil {
-		if res.status > 0 {
+		if errors.Is(res.err, ErrNotFound) {
 			// App does not exist
 			app.Id = ""
 			log.Printf("[DEBUG] app %s does not exist\n", appName)
-			// return nil, err
 			return app, nil
 		} else {
 			return nil, res.err
 		}
 	}
 
-	app.ConfigVars = readAppConfig(appName, client)
-	domains, err := readAppDomains(appName, client)
+	locked, err := readAppLocked(ctx, appName, client)
+	if err != nil {
+		return nil, err
+	}
+	app.Locked = locked
+
+	config, err := readAppConfig(ctx, appName, client)
+	if err != nil {
+		return nil, err
+	}
+	app.ConfigVars = config
+
+	domains, err := readAppDomains(ctx, appName, client)
 	if err != nil {
 		return nil, err
 	}
 	app.Domains = domains
 
-	buildpacks, err := readAppBuildpacks(appName, client)
+	buildpacks, err := readAppBuildpacks(ctx, appName, client)
 	if err != nil {
 		return nil, err
 	}
 	app.Buildpacks = buildpacks
 
-	// ssl, err := readAppSsl(appName, client)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// app.Ssl = ssl
+	builder, err := readAppBuilder(ctx, appName, client, d)
+	if err != nil {
+		return nil, err
+	}
+	app.Builder = builder
+
+	ports, err := readAppPorts(ctx, appName, client)
+	if err != nil {
+		return nil, err
+	}
+	app.Ports = ports
+
+	proxyType, proxyEnabled, err := readAppProxyReport(ctx, appName, client)
+	if err != nil {
+		return nil, err
+	}
+	app.ProxyType = proxyType
+	app.ProxyEnabled = proxyEnabled
+
+	if app.usesNginx() {
+		err = app.readNginx(ctx, client, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if attributeSet(d, "checks") {
+		checks, err := readAppChecksReport(ctx, appName, client)
+		if err != nil {
+			return nil, err
+		}
+		app.Checks = checks
+	}
+
+	if attributeSet(d, "process_scale") {
+		processScale, err := readAppProcessScale(ctx, appName, client)
+		if err != nil {
+			return nil, err
+		}
+		app.ProcessScale = processScale
+	}
+
+	if attributeSet(d, "resources") {
+		resources, err := readAppResources(ctx, appName, client)
+		if err != nil {
+			return nil, err
+		}
+		app.Resources = resources
+	}
+
+	if attributeSet(d, "docker_options") {
+		dockerOptions, err := readAppDockerOptions(ctx, appName, client)
+		if err != nil {
+			return nil, err
+		}
+		app.DockerOptions = dockerOptions
+	}
+
+	if attributeSet(d, "git_sync") {
+		gitReport, err := readAppGitReport(ctx, appName, client)
+		if err != nil {
+			return nil, err
+		}
+		app.GitSha = gitReport["Git sha"]
+	}
+
+	return app, nil
+}
+
+// Whether the attribute is set in the config or state
+func attributeSet(d *schema.ResourceData, attribute string) bool {
+	_, ok := d.GetOk(attribute)
+	return ok
+}
+
+// Read the app's nginx properties, template path & rendered config
+func (app *DokkuApp) readNginx(ctx context.Context, client *DokkuClient, d *schema.ResourceData) error {
+	nginxReport, err := readAppNginxReport(ctx, app.Name, client)
+	if err != nil {
+		return err
+	}
+
+	// Dokku uses 0.0.0.0 and :: for ipv4/ipv6 bind addresses respectively by
+	// default. However, in the stdout ipv4 is shown as a blank string
+	// as of writing (dokku v0.25.7). We therefore make our own assumptions here
+	// if these properties contain blanks.
+	if ipv4Addr, ok := nginxReport["bind-address-ipv4"]; ok {
+		app.NginxBindAddressIpv4 = ipv4Addr
+	} else {
+		app.NginxBindAddressIpv4 = "0.0.0.0"
+	}
+
+	if ipv6Addr, ok := nginxReport["bind-address-ipv6"]; ok {
+		app.NginxBindAddressIpv6 = ipv6Addr
+	} else {
+		app.NginxBindAddressIpv6 = "::"
+	}
+
+	app.Nginx = make(map[string]string)
+	for _, property := range dokkuNginxProperties {
+		if value := nginxReport[property]; value != "" {
+			app.Nginx[property] = value
+		}
+	}
+
+	app.NginxConfSigilPath = nginxReport["nginx-conf-sigil-path"]
+
+	// The rendered config is only of interest when it's customised
+	if !attributeSet(d, "nginx") && !attributeSet(d, "nginx_conf_sigil_path") {
+		return nil
+	}
+
+	nginxConfig, err := readAppNginxConfig(ctx, app.Name, client)
+	if err != nil {
+		return err
+	}
+	app.NginxConfig = nginxConfig
+
+	return nil
+}
+
+// The app's proxy type & whether the proxy is enabled, from proxy:report
+func readAppProxyReport(ctx context.Context, appName string, client *DokkuClient) (string, bool, error) {
+	res := run(ctx, client, fmt.Sprintf("proxy:report %s", appName))
+
+	if res.err != nil {
+		return "", false, res.err
+	}
+
+	report := parseKeyValues(strings.Split(res.stdout, "\n")[1:])
+
+	// The computed type falls back to the global type when the app doesn't
+	// have one of its own
+	proxyType := report["Proxy computed type"]
+	if proxyType == "" {
+		proxyType = report["Proxy type"]
+	}
+
+	return proxyType, report["Proxy enabled"] != "false", nil
+}
+
+// Whether deploys to the app are locked, from apps:report
+func readAppLocked(ctx context.Context, appName string, client *DokkuClient) (bool, error) {
+	res := run(ctx, client, fmt.Sprintf("apps:report %s", appName))
+
+	if res.err != nil {
+		return false, res.err
+	}
+
+	report := parseKeyValues(strings.Split(res.stdout, "\n")[1:])
+
+	return report["App locked"] == "true", nil
+}
+
+func readAppConfig(ctx context.Context, appName string, sshClient *DokkuClient) (map[string]string, error) {
+	res := run(ctx, sshClient, fmt.Sprintf("config:show %s", appName))
+
+	// fails rather than listing nothing if the app has no config vars
+	if res.err != nil && strings.Contains(strings.ToLower(res.stderr+res.stdout), "no config vars") {
+		return map[string]string{}, nil
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	configLines := strings.Split(res.stdout, "\n")
+
+	// TODO validate first line of output
+
+	keyPairs := configLines[1:]
+
+	config := make(map[string]string)
+
+	for _, kp := range keyPairs {
+		kp = strings.TrimSpace(kp)
+		if len(kp) > 0 {
+			parts := strings.Split(kp, ":")
+			configKey := strings.TrimSpace(parts[0])
+
+			configVal := parts[1]
+			if len(parts[1]) > 1 {
+				configVal = strings.Join(parts[1:], ":")
+			}
+			configVal = strings.TrimSpace(configVal)
+
+			config[configKey] = configVal
+		}
+	}
+
+	return config, nil
+}
+
+//
+func readAppDomains(ctx context.Context, appName string, client *DokkuClient) ([]string, error) {
+	res := run(ctx, client, fmt.Sprintf("domains:report %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	domainLines := strings.Split(res.stdout, "\n")[1:]
+
+	for _, line := range domainLines {
+		parts := strings.Split(line, ":")
+
+		key := strings.TrimSpace(parts[0])
+
+		if key == "Domains app vhosts" {
+			domainList := strings.TrimSpace(parts[1])
+			if domainList == "" {
+				return []string{}, nil
+			} else {
+				return strings.Split(domainList, " "), nil
+			}
+		}
+	}
+
+	// TODO proper error handling
+	return nil, nil
+}
+
+// TODO Some parsing logic here that is replicated elsewhere (e.g readAppDomains above)
+// which we can make reusable
+func readAppBuildpacks(ctx context.Context, appName string, client *DokkuClient) ([]string, error) {
+	res := run(ctx, client, fmt.Sprintf("buildpacks:list %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	buildpackLines := strings.Split(res.stdout, "\n")[1:]
+	buildpacks := []string{}
+
+	for _, line := range buildpackLines {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			buildpacks = append(buildpacks, line)
+		}
+	}
+
+	return buildpacks, nil
+}
+
+// The app's builder properties, from builder:report and the builder-*:report
+// of each builder with properties. Properties of builders that the host's
+// version of dokku doesn't have are left out.
+func readAppBuilder(ctx context.Context, appName string, client *DokkuClient, d *schema.ResourceData) (map[string]string, error) {
+	reports := make(map[string]map[string]string)
+	builder := make(map[string]string)
+
+	for _, property := range dokkuBuilderProperties {
+		// Each plugin's report is only read for the properties that are set
+		if !attributeSet(d, property.attribute) {
+			continue
+		}
+
+		if !property.supported(client, property.reportOp) {
+			continue
+		}
+
+		cmd, err := property.command(client, property.reportOp, "report")
+		if err != nil {
+			return nil, err
+		}
+
+		report, ok := reports[property.plugin]
+		if !ok {
+			res := run(ctx, client, fmt.Sprintf("%s %s", cmd, appName))
 
-	ports, err := readAppPorts(appName, client)
+			if res.err != nil {
+				return nil, res.err
+			}
+
+			report = parseKeyValues(strings.Split(res.stdout, "\n")[1:])
+			reports[property.plugin] = report
+		}
+
+		if value := report[property.reportKey()]; value != "" {
+			builder[property.attribute] = value
+		}
+	}
+
+	return builder, nil
+}
+
+func readAppPorts(ctx context.Context, appName string, client *DokkuClient) ([]string, error) {
+	listCmd, err := client.Cmd(opPortsList)
 	if err != nil {
 		return nil, err
 	}
-	app.Ports = ports
 
-	nginxReport, err := readAppNginxReport(appName, client)
+	res := run(ctx, client, fmt.Sprintf("%s %s", listCmd, appName))
+
+	// returns status code 1 if no ports set
+	if res.err != nil && strings.Contains(res.stderr+res.stdout, "No port mappings") {
+		return []string{}, nil
+	}
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	portsLines := strings.Split(res.stdout, "\n")
+	if len(portsLines) <= 2 {
+		return []string{}, nil
+	}
+	portsLines = portsLines[2:]
+
+	var portMapping []string
+
+	for _, line := range portsLines {
+		split := strings.Split(line, " ")
+		var parts []string
+
+		for _, str := range split {
+			if strings.TrimSpace(str) != "" {
+				parts = append(parts, str)
+			}
+		}
+
+		if len(parts) == 3 {
+			portMapping = append(portMapping, strings.Join(parts, ":"))
+		}
+	}
+
+	return portMapping, nil
+}
+
+// nginx property (e.g bind-address-ipv4) -> value, as shown by nginx:report,
+// which includes the computed & global values e.g computed-bind-address-ipv4
+type DokkuAppNginxReport map[string]string
+
+func readAppNginxReport(ctx context.Context, appName string, client *DokkuClient) (DokkuAppNginxReport, error) {
+	res := run(ctx, client, fmt.Sprintf("nginx:report %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	stdoutLines := strings.Split(res.stdout, "\n")[1:]
+
+	report := DokkuAppNginxReport{}
+
+	// Keys are the property with dashes replaced by spaces, e.g
+	// "Nginx bind address ipv4"
+	for key, value := range parseKeyValues(stdoutLines) {
+		if property, ok := strings.CutPrefix(key, "Nginx "); ok {
+			report[strings.ReplaceAll(strings.ToLower(property), " ", "-")] = value
+		}
+	}
+
+	return report, nil
+}
+
+// The app's rendered nginx.conf, from nginx:show-config. Apps that haven't
+// been deployed don't have one.
+func readAppNginxConfig(ctx context.Context, appName string, client *DokkuClient) (string, error) {
+	deployed, err := readAppDeployed(ctx, appName, client)
+	if err != nil || !deployed {
+		return "", err
+	}
+
+	res := run(ctx, client, fmt.Sprintf("nginx:show-config %s", appName))
+	if res.err != nil {
+		return "", res.err
+	}
+
+	return res.stdout, nil
+}
+
+//
+func readAppChecksReport(ctx context.Context, appName string, client *DokkuClient) (*DokkuAppChecks, error) {
+	res := run(ctx, client, fmt.Sprintf("checks:report %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	stdoutLines := strings.Split(res.stdout, "\n")[1:]
+
+	checksOpts := parseKeyValues(stdoutLines)
+
+	checks := &DokkuAppChecks{
+		Disabled: parseChecksList(checksOpts["Checks disabled list"]),
+		Skipped:  parseChecksList(checksOpts["Checks skipped list"]),
+	}
+
+	// Unset, it's blank, which we treat as 0 i.e the default
+	checks.WaitToRetire, _ = strconv.Atoi(checksOpts["Checks wait to retire"])
+
+	return checks, nil
+}
+
+// Read the number of processes of each type from `ps:scale`, which outputs e.g
+//
+//	-----> Scaling for my-app
+//	proctype: qty
+//	--------: ---
+//	web:  3
+//	worker: 2
+//
+// Depending on the dokku version, each line may be prefixed with "-----> "
+func readAppProcessScale(ctx context.Context, appName string, client *DokkuClient) (map[string]int, error) {
+	res := run(ctx, client, fmt.Sprintf("ps:scale %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	scale := make(map[string]int)
+
+	for _, line := range strings.Split(res.stdout, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "----->"))
+
+		parts := strings.Split(line, ":")
+		if len(parts) != 2 {
+			continue
+		}
+
+		procType := strings.TrimSpace(parts[0])
+		count, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			// the header lines
+			continue
+		}
+
+		scale[procType] = count
+	}
+
+	return scale, nil
+}
+
+// Read the limits & reservations for each process type from resource:report,
+// which has a line per process type, resource and type of the form
+//
+//	Resource web limit memory swap:     1g
+//
+// The default process type is shown as "_default_" or "default" depending on
+// the dokku version.
+func readAppResources(ctx context.Context, appName string, client *DokkuClient) (map[string]*DokkuAppResources, error) {
+	res := run(ctx, client, fmt.Sprintf("resource:report %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	report := parseKeyValues(strings.Split(res.stdout, "\n")[1:])
+	resources := make(map[string]*DokkuAppResources)
+
+	for key, value := range report {
+		parts := strings.SplitN(key, " ", 4)
+		if len(parts) != 4 || parts[0] != "Resource" || (parts[2] != "limit" && parts[2] != "reserve") {
+			continue
+		}
+
+		procType := parts[1]
+		if procType == "default" {
+			procType = defaultProcessType
+		}
+
+		resourceType := strings.ReplaceAll(parts[3], " ", "-")
+		if _, ok := dokkuResourceTypes[resourceType]; !ok {
+			continue
+		}
+
+		if _, ok := resources[procType]; !ok {
+			resources[procType] = &DokkuAppResources{
+				ProcessType: procType,
+				Limit:       make(map[string]string),
+				Reserve:     make(map[string]string),
+			}
+		}
+
+		if parts[2] == "limit" {
+			resources[procType].Limit[resourceType] = value
+		} else {
+			resources[procType].Reserve[resourceType] = value
+		}
+	}
+
+	return resources, nil
+}
+
+// Read the docker options for each phase from docker-options:report, where
+// they're shown space separated on a line per phase, e.g
+//
+//	Docker options deploy:   --restart=on-failure:10 -v /var/lib/dokku/data/storage/app:/data
+//
+// Options are split on each word beginning with a dash, so that an option and
+// its value (e.g `-v /a:/b`) are kept together.
+func readAppDockerOptions(ctx context.Context, appName string, client *DokkuClient) (map[string][]string, error) {
+	res := run(ctx, client, fmt.Sprintf("docker-options:report %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	report := parseKeyValues(strings.Split(res.stdout, "\n")[1:])
+	options := make(map[string][]string)
+
+	for _, phase := range dokkuDockerOptionPhases {
+		options[phase] = splitDockerOptions(report["Docker options "+phase])
+	}
+
+	return options, nil
+}
+
+func splitDockerOptions(str string) []string {
+	options := []string{}
+
+	for _, word := range strings.Fields(str) {
+		if strings.HasPrefix(word, "-") || len(options) == 0 {
+			options = append(options, word)
+		} else {
+			options[len(options)-1] += " " + word
+		}
+	}
+
+	return options
+}
+
+// Whether the app has been deployed, from ps:report
+func readAppDeployed(ctx context.Context, appName string, client *DokkuClient) (bool, error) {
+	res := run(ctx, client, fmt.Sprintf("ps:report %s", appName))
+
+	if res.err != nil {
+		return false, res.err
+	}
+
+	report := parseKeyValues(strings.Split(res.stdout, "\n")[1:])
+
+	return report["Deployed"] == "true", nil
+}
+
+// The app's git:report, keyed by the report's labels e.g "Git sha"
+func readAppGitReport(ctx context.Context, appName string, client *DokkuClient) (map[string]string, error) {
+	res := run(ctx, client, fmt.Sprintf("git:report %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	return parseKeyValues(strings.Split(res.stdout, "\n")[1:]), nil
+}
+
+//
+func dokkuAppCreate(ctx context.Context, app *DokkuApp, client *DokkuClient) error {
+	res := run(ctx, client, fmt.Sprintf("apps:create %s", app.Name))
+
+	log.Printf("[DEBUG] apps:create %v\n", res.stdout)
+
+	if res.err != nil {
+		return res.err
+	}
+
+	err := dokkuAppConfigVarsSet(ctx, app, client)
+
+	if err != nil {
+		return err
+	}
+
+	err = dokkuAppDomainsAdd(ctx, app, client)
+
+	if err != nil {
+		return err
+	}
+
+	err = dokkuAppBuildpackAdd(ctx, app.Name, app.Buildpacks, client)
+
+	if err != nil {
+		return err
+	}
+
+	for _, property := range dokkuBuilderProperties {
+		if value := app.Builder[property.attribute]; value != "" {
+			err = dokkuAppBuilderSet(ctx, app.Name, property, value, client)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = dokkuAppPortsAdd(ctx, app.Name, app.Ports, client)
+
+	if err != nil {
+		return err
+	}
+
+	if app.ProxyType != "" {
+		err = dokkuAppProxyTypeSet(ctx, app.Name, app.ProxyType, client)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if !app.ProxyEnabled {
+		err = dokkuAppProxyEnabledSet(ctx, app.Name, false, client)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Without a proxy type of its own the app uses the global one, which
+	// might not be nginx
+	app.ProxyType, _, err = readAppProxyReport(ctx, app.Name, client)
+
 	if err != nil {
-		return nil, err
+		return err
 	}
-	app.NginxBindAddressIpv4 = nginxReport.BindAddressIpv4
-	app.NginxBindAddressIpv6 = nginxReport.BindAddressIpv6
-
-	return app, nil
-}
 
-// TODO error handling
-func readAppConfig(appName string, sshClient *goph.Client) map[string]string {
-	res := run(sshClient, fmt.Sprintf("config:show %s", appName))
+	if app.usesNginx() {
+		err = dokkuAppNginxOptSet(ctx, app.Name, "bind-address-ipv4", app.NginxBindAddressIpv4, client)
 
-	// if err {
-	// 	// TODO
-	// }
+		if err != nil {
+			return err
+		}
 
-	configLines := strings.Split(res.stdout, "\n")
+		err = dokkuAppNginxOptSet(ctx, app.Name, "bind-address-ipv6", app.NginxBindAddressIpv6, client)
 
-	// TODO validate first line of output
+		if err != nil {
+			return err
+		}
 
-	keyPairs := configLines[1:]
+		for _, property := range sortedKeys(app.Nginx) {
+			err = dokkuAppNginxOptSet(ctx, app.Name, property, app.Nginx[property], client)
 
-	config := make(map[string]string)
+			if err != nil {
+				return err
+			}
+		}
 
-	for _, kp := range keyPairs {
-		kp = strings.TrimSpace(kp)
-		if len(kp) > 0 {
-			parts := strings.Split(kp, ":")
-			configKey := strings.TrimSpace(parts[0])
+		if app.NginxConfSigilPath != "" {
+			err = dokkuAppNginxOptSet(ctx, app.Name, "nginx-conf-sigil-path", app.NginxConfSigilPath, client)
 
-			configVal := parts[1]
-			if len(parts[1]) > 1 {
-				configVal = strings.Join(parts[1:], ":")
+			if err != nil {
+				return err
 			}
-			configVal = strings.TrimSpace(configVal)
-
-			config[configKey] = configVal
 		}
 	}
 
-	return config
-}
-
-//
-func readAppDomains(appName string, client *goph.Client) ([]string, error) {
-	res := run(client, fmt.Sprintf("domains:report %s", appName))
+	for _, phase := range dokkuDockerOptionPhases {
+		err = dokkuAppDockerOptionsSet(ctx, app.Name, phase, app.DockerOptions[phase], true, client)
 
-	if res.err != nil {
-		return nil, res.err
+		if err != nil {
+			return err
+		}
 	}
 
-	domainLines := strings.Split(res.stdout, "\n")[1:]
+	err = dokkuAppChecksSet(ctx, app.Name, nil, app.Checks, client)
 
-	for _, line := range domainLines {
-		parts := strings.Split(line, ":")
+	if err != nil {
+		return err
+	}
 
-		key := strings.TrimSpace(parts[0])
+	for _, resources := range app.Resources {
+		err = dokkuAppResourcesSet(ctx, app.Name, resources, client)
 
-		if key == "Domains app vhosts" {
-			domainList := strings.TrimSpace(parts[1])
-			if domainList == "" {
-				return []string{}, nil
-			} else {
-				return strings.Split(domainList, " "), nil
-			}
+		if err != nil {
+			return err
 		}
 	}
 
-	// TODO proper error handling
-	return nil, nil
-}
-
-// TODO Some parsing logic here that is replicated elsewhere (e.g readAppDomains above)
-// which we can make reusable
-func readAppBuildpacks(appName string, client *goph.Client) ([]string, error) {
-	res := run(client, fmt.Sprintf("buildpacks:list %s", appName))
+	err = dokkuAppProcessScaleSet(ctx, app.Name, app.ProcessScale, client)
 
-	if res.err != nil {
-		return nil, res.err
+	if err != nil {
+		return err
 	}
 
-	buildpackLines := strings.Split(res.stdout, "\n")[1:]
-	buildpacks := []string{}
+	// Synced (and so deployed) once everything it's deployed with is in place
+	if app.GitSync != nil {
+		err = dokkuAppGitSync(ctx, app.Name, app.GitSync, client)
 
-	for _, line := range buildpackLines {
-		line = strings.TrimSpace(line)
-		if len(line) > 0 {
-			buildpacks = append(buildpacks, line)
+		if err != nil {
+			return err
 		}
 	}
 
-	return buildpacks, nil
-}
+	// Lock last, so that nothing above is blocked by it
+	if app.Locked {
+		return dokkuAppLockSet(ctx, app.Name, true, client)
+	}
 
-func readAppPorts(appName string, client *goph.Client) ([]string, error) {
-	res := run(client, fmt.Sprintf("%s %s", portReadCmd(), appName))
+	return nil
+}
 
-	portsLines := strings.Split(res.stdout, "\n")
+// Fetch the app's code from the git repository, and build it if requested
+func dokkuAppGitSync(ctx context.Context, appName string, sync *DokkuAppGitSync, client *DokkuClient) error {
+	cmd := "git:sync"
+	if sync.Build {
+		cmd += " --build"
+	}
 
-	// returns status code 1 if no ports set
-	if len(portsLines) <= 2 || res.status > 0 {
-		return []string{}, nil
+	cmd = fmt.Sprintf("%s %s %s", cmd, appName, shellescape.Quote(sync.Remote))
+	if sync.Ref != "" {
+		cmd = fmt.Sprintf("%s %s", cmd, shellescape.Quote(sync.Ref))
 	}
-	portsLines = portsLines[2:]
 
-	if res.err != nil {
-		return nil, res.err
+	return run(ctx, client, cmd).err
+}
+
+// Go from the old checks (nil if they weren't managed) to the new (nil to
+// return to dokku's defaults), changing only what differs
+func dokkuAppChecksSet(ctx context.Context, appName string, old *DokkuAppChecks, new *DokkuAppChecks, client *DokkuClient) error {
+	if old == nil {
+		old = &DokkuAppChecks{}
+	}
+	if new == nil {
+		new = &DokkuAppChecks{}
 	}
 
-	var portMapping []string
+	oldTypes := append(append([]string{}, old.Disabled...), old.Skipped...)
+	newTypes := append(append([]string{}, new.Disabled...), new.Skipped...)
 
-	for _, line := range portsLines {
-		split := strings.Split(line, " ")
-		var parts []string
+	changes := []struct {
+		subcommand   string
+		processTypes []string
+	}{
+		{"enable", calculateMissingStrings(newTypes, oldTypes)},
+		{"disable", calculateMissingStrings(old.Disabled, new.Disabled)},
+		{"skip", calculateMissingStrings(old.Skipped, new.Skipped)},
+	}
 
-		for _, str := range split {
-			if strings.TrimSpace(str) != "" {
-				parts = append(parts, str)
-			}
+	for _, change := range changes {
+		if len(change.processTypes) == 0 {
+			continue
 		}
+		sort.Strings(change.processTypes)
 
-		if len(parts) == 3 {
-			portMapping = append(portMapping, strings.Join(parts, ":"))
+		res := run(ctx, client, fmt.Sprintf("checks:%s %s %s", change.subcommand, appName, strings.Join(change.processTypes, ",")))
+		if res.err != nil {
+			return res.err
 		}
 	}
 
-	return portMapping, nil
-}
-
-type DokkuAppNginxReport struct {
-	BindAddressIpv4 string
-	BindAddressIpv6 string
-}
+	if old.WaitToRetire == new.WaitToRetire {
+		return nil
+	}
 
-//
-func readAppNginxReport(appName string, client *goph.Client) (DokkuAppNginxReport, error) {
-	res := run(client, fmt.Sprintf("nginx:report %s", appName))
+	cmd := fmt.Sprintf("checks:set %s wait-to-retire", appName)
+	if new.WaitToRetire != 0 {
+		cmd = fmt.Sprintf("%s %d", cmd, new.WaitToRetire)
+	}
 
-	report := DokkuAppNginxReport{}
+	res := run(ctx, client, cmd)
+	return res.err
+}
 
-	if res.err != nil {
-		return report, res.err
+// Scale the given process types. Apps that haven't been deployed yet are scaled
+// with --skip-deploy, which records the scale for when they are.
+func dokkuAppProcessScaleSet(ctx context.Context, appName string, scale map[string]int, client *DokkuClient) error {
+	if len(scale) == 0 {
+		return nil
 	}
 
-	stdoutLines := strings.Split(res.stdout, "\n")[1:]
-
-	nginxOpts := parseKeyValues(stdoutLines)
+	deployed, err := readAppDeployed(ctx, appName, client)
+	if err != nil {
+		return err
+	}
 
-	// Dokku uses 0.0.0.0 and :: for ipv4/ipv6 bind addresses respectively by
-	// default. However, in the stdout ipv4 is shown as a blank string
-	// as of writing (dokku v0.25.7). We therefore make our own assumptions here
-	// if these properties contain blanks.
+	procTypes := make([]string, 0, len(scale))
+	for procType := range scale {
+		procTypes = append(procTypes, procType)
+	}
+	sort.Strings(procTypes)
 
-	if ipv4Addr, ok := nginxOpts["Nginx bind address ipv4"]; ok {
-		report.BindAddressIpv4 = ipv4Addr
-	} else {
-		report.BindAddressIpv4 = "0.0.0.0"
+	args := make([]string, 0, len(scale))
+	for _, procType := range procTypes {
+		args = append(args, fmt.Sprintf("%s=%d", procType, scale[procType]))
 	}
 
-	if ipv6Addr, ok := nginxOpts["Nginx bind address ipv6"]; ok {
-		report.BindAddressIpv6 = ipv6Addr
-	} else {
-		report.BindAddressIpv6 = "::"
+	flags := ""
+	if !deployed {
+		flags = "--skip-deploy "
 	}
 
-	return report, nil
+	res := run(ctx, client, fmt.Sprintf("ps:scale %s%s %s", flags, appName, strings.Join(args, " ")))
+	return res.err
 }
 
-//
-func dokkuAppCreate(app *DokkuApp, client *goph.Client) error {
-	res := run(client, fmt.Sprintf("apps:create %s", app.Name))
+// Apply the limits & reservations for a process type. Any existing ones are
+// cleared first, so that resource types no longer set are removed. These take
+// effect the next time the app is deployed.
+func dokkuAppResourcesSet(ctx context.Context, appName string, resources *DokkuAppResources, client *DokkuClient) error {
+	for _, kind := range []string{"limit", "reserve"} {
+		values := resources.Limit
+		if kind == "reserve" {
+			values = resources.Reserve
+		}
 
-	log.Printf("[DEBUG] apps:create %v\n", res.stdout)
+		processTypeFlag := ""
+		if resources.ProcessType != defaultProcessType {
+			processTypeFlag = fmt.Sprintf("--process-type %s ", resources.ProcessType)
+		}
 
-	if res.err != nil {
-		return res.err
-	}
+		res := run(ctx, client, fmt.Sprintf("resource:%s-clear %s%s", kind, processTypeFlag, appName))
+		if res.err != nil {
+			return res.err
+		}
 
-	err := dokkuAppConfigVarsSet(app, client)
+		if len(values) == 0 {
+			continue
+		}
 
-	if err != nil {
-		return err
-	}
+		resourceTypes := make([]string, 0, len(values))
+		for resourceType := range values {
+			resourceTypes = append(resourceTypes, resourceType)
+		}
+		sort.Strings(resourceTypes)
 
-	err = dokkuAppDomainsAdd(app, client)
+		flags := make([]string, 0, len(values))
+		for _, resourceType := range resourceTypes {
+			flags = append(flags, fmt.Sprintf("--%s %s", resourceType, shellescape.Quote(values[resourceType])))
+		}
 
-	if err != nil {
-		return err
+		res = run(ctx, client, fmt.Sprintf("resource:%s %s%s %s", kind, processTypeFlag, strings.Join(flags, " "), appName))
+		if res.err != nil {
+			return res.err
+		}
 	}
 
-	err = dokkuAppBuildpackAdd(app.Name, app.Buildpacks, client)
+	return nil
+}
 
-	if err != nil {
-		return err
+// Add (or remove) docker options for a phase
+func dokkuAppDockerOptionsSet(ctx context.Context, appName string, phase string, options []string, add bool, client *DokkuClient) error {
+	cmd := "docker-options:remove"
+	if add {
+		cmd = "docker-options:add"
 	}
 
-	err = dokkuAppPortsAdd(app.Name, app.Ports, client)
+	for _, option := range options {
+		res := run(ctx, client, fmt.Sprintf("%s %s %s %s", cmd, appName, phase, shellescape.Quote(option)))
 
-	if err != nil {
-		return err
+		if res.err != nil {
+			return res.err
+		}
 	}
 
-	err = dokkuAppNginxOptSet(app.Name, "bind-address-ipv4", app.NginxBindAddressIpv4, client)
+	return nil
+}
 
-	if err != nil {
-		return err
+// Lock or unlock deploys to the app
+func dokkuAppLockSet(ctx context.Context, appName string, locked bool, client *DokkuClient) error {
+	cmd := "apps:unlock"
+	if locked {
+		cmd = "apps:lock"
 	}
 
-	err = dokkuAppNginxOptSet(app.Name, "bind-address-ipv6", app.NginxBindAddressIpv6, client)
-
-	return err
+	res := run(ctx, client, fmt.Sprintf("%s %s", cmd, appName))
+	return res.err
 }
 
 //
-func dokkuAppConfigVarsSet(app *DokkuApp, client *goph.Client) error {
+func dokkuAppConfigVarsSet(ctx context.Context, app *DokkuApp, client *DokkuClient) error {
 	configVarStr := app.configVarsStr()
 	if len(configVarStr) == 0 {
 		return nil
@@ -399,40 +1467,40 @@ func dokkuAppConfigVarsSet(app *DokkuApp, client *goph.Client) error {
 		secrets = append(secrets, v)
 	}
 
-	res := run(client, fmt.Sprintf("config:set %s %s", app.Name, configVarStr), secrets...)
+	res := run(ctx, client, fmt.Sprintf("config:set %s %s", app.Name, configVarStr), secrets...)
 	return res.err
 }
 
 //
-func dokkuAppConfigVarsUnset(app *DokkuApp, varsToUnset []string, client *goph.Client) error {
+func dokkuAppConfigVarsUnset(ctx context.Context, app *DokkuApp, varsToUnset []string, client *DokkuClient) error {
 	if len(varsToUnset) == 0 {
 		return nil
 	}
 	log.Printf("[DEBUG] Unsetting keys %v\n", varsToUnset)
 	cmd := fmt.Sprintf("config:unset %s %s", app.Name, strings.Join(varsToUnset, " "))
 	log.Printf("[DEBUG] running %s", cmd)
-	res := run(client, cmd)
+	res := run(ctx, client, cmd)
 
 	return res.err
 }
 
 //
-func dokkuAppDomainsAdd(app *DokkuApp, client *goph.Client) error {
+func dokkuAppDomainsAdd(ctx context.Context, app *DokkuApp, client *DokkuClient) error {
 	domainStr := strings.Join(app.Domains, " ")
 
 	if len(domainStr) > 0 {
-		res := run(client, fmt.Sprintf("domains:set %s %s", app.Name, domainStr))
+		res := run(ctx, client, fmt.Sprintf("domains:set %s %s", app.Name, domainStr))
 		return res.err
 	}
 	return nil
 }
 
 // Add buildpacks to an app based on the DokkuApp instance
-func dokkuAppBuildpackAdd(appName string, buildpacks []string, client *goph.Client) error {
+func dokkuAppBuildpackAdd(ctx context.Context, appName string, buildpacks []string, client *DokkuClient) error {
 	for _, pack := range buildpacks {
 		pack = strings.TrimSpace(pack)
 		if len(pack) > 0 {
-			res := run(client, fmt.Sprintf("buildpacks:add %s %s", appName, pack))
+			res := run(ctx, client, fmt.Sprintf("buildpacks:add %s %s", appName, pack))
 
 			if res.err != nil {
 				return res.err
@@ -442,12 +1510,39 @@ func dokkuAppBuildpackAdd(appName string, buildpacks []string, client *goph.Clie
 	return nil
 }
 
+// Set a builder property, or unset it when the value is empty
+func dokkuAppBuilderSet(ctx context.Context, appName string, property dokkuBuilderProperty, value string, client *DokkuClient) error {
+	if !property.supported(client, property.setOp) {
+		if value == "" {
+			return nil
+		}
+		return fmt.Errorf("%s isn't supported by the host's version of dokku (%s)", property.attribute, client.Version)
+	}
+
+	setCmd, err := property.command(client, property.setOp, "set")
+	if err != nil {
+		return err
+	}
+
+	cmd := fmt.Sprintf("%s %s %s", setCmd, appName, property.property)
+	if value != "" {
+		cmd = fmt.Sprintf("%s %s", cmd, shellescape.Quote(value))
+	}
+
+	return run(ctx, client, cmd).err
+}
+
 //
-func dokkuAppPortsAdd(appName string, ports []string, client *goph.Client) error {
+func dokkuAppPortsAdd(ctx context.Context, appName string, ports []string, client *DokkuClient) error {
+	addCmd, err := client.Cmd(opPortsAdd)
+	if err != nil {
+		return err
+	}
+
 	for _, portRange := range ports {
 		portRange = strings.TrimSpace(portRange)
 		if len(portRange) > 0 {
-			res := run(client, fmt.Sprintf("%s %s %s", portAddCmd(), appName, portRange))
+			res := run(ctx, client, fmt.Sprintf("%s %s %s", addCmd, appName, portRange))
 
 			if res.err != nil {
 				return res.err
@@ -458,16 +1553,68 @@ func dokkuAppPortsAdd(appName string, ports []string, client *goph.Client) error
 	return nil
 }
 
-func dokkuAppNginxOptSet(appName string, property string, value string, client *goph.Client) error {
-	res := run(client, fmt.Sprintf("nginx:set %s %s %s", appName, property, value))
+// Process types with checks disabled/skipped are listed comma separated, or
+// as "none"
+func parseChecksList(str string) []string {
+	list := []string{}
+
+	for _, processType := range strings.Split(str, ",") {
+		processType = strings.TrimSpace(processType)
+		if processType != "" && processType != "none" {
+			list = append(list, processType)
+		}
+	}
+
+	return list
+}
+
+// Set an nginx property, or unset it when the value is empty
+func dokkuAppNginxOptSet(ctx context.Context, appName string, property string, value string, client *DokkuClient) error {
+	cmd := fmt.Sprintf("nginx:set %s %s", appName, property)
+	if value != "" {
+		cmd = fmt.Sprintf("%s %s", cmd, shellescape.Quote(value))
+	}
+
+	res := run(ctx, client, cmd)
 	return res.err
 }
 
+// Set the app's proxy type, or go back to the global one when empty
+func dokkuAppProxyTypeSet(ctx context.Context, appName string, proxyType string, client *DokkuClient) error {
+	cmd := fmt.Sprintf("proxy:set %s", appName)
+	if proxyType != "" {
+		cmd = fmt.Sprintf("%s %s", cmd, proxyType)
+	}
+
+	return run(ctx, client, cmd).err
+}
+
+func dokkuAppProxyEnabledSet(ctx context.Context, appName string, enabled bool, client *DokkuClient) error {
+	subcommand := "disable"
+	if enabled {
+		subcommand = "enable"
+	}
+
+	return run(ctx, client, fmt.Sprintf("proxy:%s %s", subcommand, appName)).err
+}
+
+// Rebuild the app's proxy config so that changes to it take effect. Apps that
+// haven't been deployed don't have any config yet, which will be built when
+// they are.
+func dokkuAppProxyBuildConfig(ctx context.Context, appName string, client *DokkuClient) error {
+	deployed, err := readAppDeployed(ctx, appName, client)
+	if err != nil || !deployed {
+		return err
+	}
+
+	return run(ctx, client, fmt.Sprintf("proxy:build-config %s", appName)).err
+}
+
 //
-func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client) error {
+func dokkuAppUpdate(ctx context.Context, app *DokkuApp, d *schema.ResourceData, client *DokkuClient) error {
 	if d.HasChange("name") {
 		old, _ := d.GetChange("name")
-		res := run(client, fmt.Sprintf("apps:rename %s %s", old.(string), d.Get("name")))
+		res := run(ctx, client, fmt.Sprintf("apps:rename %s %s", old.(string), d.Get("name")))
 		log.Printf("[DEBUG] apps:rename %s %s : %v\n", old.(string), d.Get("name"), res.stdout)
 		if res.err != nil {
 			return res.err
@@ -476,6 +1623,14 @@ func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client)
 
 	appName := d.Get("name").(string)
 
+	// Unlock before making any other changes, and lock after them (see below)
+	if d.HasChange("locked") && !app.Locked {
+		err := dokkuAppLockSet(ctx, appName, false, client)
+		if err != nil {
+			return err
+		}
+	}
+
 	if d.HasChange("config_vars") {
 		log.Println("[DEBUG] Changing config keys...")
 
@@ -485,7 +1640,7 @@ func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client)
 
 		keysToDelete := calculateMissingKeys(newConfigVar, oldConfigVars)
 
-		dokkuAppConfigVarsUnset(app, keysToDelete, client)
+		dokkuAppConfigVarsUnset(ctx, app, keysToDelete, client)
 
 		// TODO shouldn't need to duplicate below we already have config set function
 		// This is basically an upsert, and will update values even if they haven't changed
@@ -502,7 +1657,7 @@ func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client)
 		if len(upsertParts) > 0 {
 			log.Printf("[DEBUG] Setting keys %v\n", keysToUpsert)
 
-			res := run(client, fmt.Sprintf("config:set %s %s", appName, strings.Join(upsertParts, " ")), secrets...)
+			res := run(ctx, client, fmt.Sprintf("config:set %s %s", appName, strings.Join(upsertParts, " ")), secrets...)
 
 			if res.err != nil {
 				return res.err
@@ -520,7 +1675,7 @@ func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client)
 		oldDomainsStr := strings.Join(domainsToRemove, " ")
 
 		if len(oldDomainsStr) > 0 {
-			res := run(client, fmt.Sprintf("domains:remove %s %s", appName, oldDomainsStr))
+			res := run(ctx, client, fmt.Sprintf("domains:remove %s %s", appName, oldDomainsStr))
 
 			if res.err != nil {
 				return res.err
@@ -531,7 +1686,7 @@ func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client)
 		newDomainsStr := strings.Join(newDomains, " ")
 
 		if len(newDomainsStr) > 0 {
-			res := run(client, fmt.Sprintf("domains:add %s %s", appName, newDomainsStr))
+			res := run(ctx, client, fmt.Sprintf("domains:add %s %s", appName, newDomainsStr))
 
 			if res.err != nil {
 				return res.err
@@ -543,14 +1698,23 @@ func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client)
 		_, newBuildpacksI := d.GetChange("buildpacks")
 		newBuildpacks := interfaceSliceToStrSlice(newBuildpacksI.([]interface{}))
 
-		res := run(client, fmt.Sprintf("buildpacks:clear %s", appName))
+		res := run(ctx, client, fmt.Sprintf("buildpacks:clear %s", appName))
 
 		if res.err != nil {
 			return res.err
 		}
 		app.Buildpacks = nil
 
-		dokkuAppBuildpackAdd(appName, newBuildpacks, client)
+		dokkuAppBuildpackAdd(ctx, appName, newBuildpacks, client)
+	}
+
+	for _, property := range dokkuBuilderProperties {
+		if d.HasChange(property.attribute) {
+			err := dokkuAppBuilderSet(ctx, appName, property, app.Builder[property.attribute], client)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	if d.HasChange("ports") {
@@ -561,11 +1725,20 @@ func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client)
 		oldPortLookup := sliceToLookupMap(oldPortList)
 		newPortLookup := sliceToLookupMap(newPortList)
 
+		removeCmd, err := client.Cmd(opPortsRemove)
+		if err != nil {
+			return err
+		}
+		addCmd, err := client.Cmd(opPortsAdd)
+		if err != nil {
+			return err
+		}
+
 		for _, p := range oldPortList {
 			if _, ok := newPortLookup[p]; !ok {
 				if len(p) > 0 {
 					// the old port isn't in the new one, lets remove it
-					res := run(client, fmt.Sprintf("%s %s %s", portRemoveCmd(), appName, p))
+					res := run(ctx, client, fmt.Sprintf("%s %s %s", removeCmd, appName, p))
 
 					if res.err != nil {
 						return res.err
@@ -578,7 +1751,7 @@ func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client)
 			if _, ok := oldPortLookup[p]; !ok {
 				if len(p) > 0 {
 					// new port missing, lets add it
-					res := run(client, fmt.Sprintf("%s %s %s", portAddCmd(), appName, p))
+					res := run(ctx, client, fmt.Sprintf("%s %s %s", addCmd, appName, p))
 
 					if res.err != nil {
 						return res.err
@@ -588,14 +1761,150 @@ func dokkuAppUpdate(app *DokkuApp, d *schema.ResourceData, client *goph.Client)
 		}
 	}
 
-	if d.HasChange("nginx_bind_address_ipv4") {
-		_, newBindAddr := d.GetChange("nginx_bind_address_ipv4")
-		dokkuAppNginxOptSet(appName, "bind-address-ipv4", newBindAddr.(string), client)
+	if d.HasChange("proxy_type") {
+		err := dokkuAppProxyTypeSet(ctx, appName, app.ProxyType, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("proxy_enabled") {
+		err := dokkuAppProxyEnabledSet(ctx, appName, app.ProxyEnabled, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Without a proxy type of its own the app uses the global one, which
+	// might not be nginx
+	if app.ProxyType == "" {
+		proxyType, _, err := readAppProxyReport(ctx, appName, client)
+		if err != nil {
+			return err
+		}
+		app.ProxyType = proxyType
+	}
+
+	if app.usesNginx() {
+		if d.HasChange("nginx_bind_address_ipv4") {
+			_, newBindAddr := d.GetChange("nginx_bind_address_ipv4")
+			dokkuAppNginxOptSet(ctx, appName, "bind-address-ipv4", newBindAddr.(string), client)
+		}
+
+		if d.HasChange("nginx_bind_address_ipv6") {
+			_, newBindAddr := d.GetChange("nginx_bind_address_ipv6")
+			dokkuAppNginxOptSet(ctx, appName, "bind-address-ipv6", newBindAddr.(string), client)
+		}
+
+		if d.HasChange("nginx") {
+			oldNginx, _ := d.GetChange("nginx")
+			oldProperties := mapOfInterfacesToMapOfStrings(oldNginx.(map[string]interface{}))
+
+			for _, property := range calculateMissingKeys(app.Nginx, oldProperties) {
+				err := dokkuAppNginxOptSet(ctx, appName, property, "", client)
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, property := range sortedKeys(app.Nginx) {
+				if oldProperties[property] == app.Nginx[property] {
+					continue
+				}
+				err := dokkuAppNginxOptSet(ctx, appName, property, app.Nginx[property], client)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if d.HasChange("nginx_conf_sigil_path") {
+			err := dokkuAppNginxOptSet(ctx, appName, "nginx-conf-sigil-path", app.NginxConfSigilPath, client)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if d.HasChanges("nginx", "nginx_conf_sigil_path", "proxy_type") {
+		err := dokkuAppProxyBuildConfig(ctx, appName, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("checks") {
+		oldChecks, _ := d.GetChange("checks")
+		err := dokkuAppChecksSet(ctx, appName, checksFromList(oldChecks.([]interface{})), app.Checks, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("docker_options") {
+		oldOptionsI, _ := d.GetChange("docker_options")
+		oldOptions := dockerOptionsFromList(oldOptionsI.([]interface{}))
+
+		for _, phase := range dokkuDockerOptionPhases {
+			err := dokkuAppDockerOptionsSet(ctx, appName, phase, calculateMissingStrings(app.DockerOptions[phase], oldOptions[phase]), false, client)
+			if err != nil {
+				return err
+			}
+
+			err = dokkuAppDockerOptionsSet(ctx, appName, phase, calculateMissingStrings(oldOptions[phase], app.DockerOptions[phase]), true, client)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if d.HasChange("resources") {
+		oldResourcesI, _ := d.GetChange("resources")
+		oldResources := resourcesFromSet(oldResourcesI.(*schema.Set))
+
+		// Clear the resources of process types removed from the config
+		for procType := range oldResources {
+			if _, ok := app.Resources[procType]; !ok {
+				err := dokkuAppResourcesSet(ctx, appName, &DokkuAppResources{ProcessType: procType}, client)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for procType, resources := range app.Resources {
+			if old, ok := oldResources[procType]; ok && reflect.DeepEqual(old, resources) {
+				continue
+			}
+
+			err := dokkuAppResourcesSet(ctx, appName, resources, client)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Process types removed from the config are left at their current scale
+	if d.HasChange("process_scale") {
+		err := dokkuAppProcessScaleSet(ctx, appName, app.ProcessScale, client)
+		if err != nil {
+			return err
+		}
 	}
 
-	if d.HasChange("nginx_bind_address_ipv6") {
-		_, newBindAddr := d.GetChange("nginx_bind_address_ipv6")
-		dokkuAppNginxOptSet(appName, "bind-address-ipv6", newBindAddr.(string), client)
+	// Only a new remote or ref is synced, toggling build alone does nothing
+	if app.GitSync != nil && d.HasChanges("git_sync.0.remote", "git_sync.0.ref") {
+		err := dokkuAppGitSync(ctx, appName, app.GitSync, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("locked") && app.Locked {
+		err := dokkuAppLockSet(ctx, appName, true, client)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
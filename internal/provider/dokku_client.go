@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"github.com/blang/semver"
+)
+
+// DokkuClient is what the provider hands to every resource as its meta. It
+// holds everything specific to the host a given provider block is configured
+// for - so that aliased providers pointing at hosts running different versions
+// of dokku don't interfere with each other.
+type DokkuClient struct {
+	Executor
+
+	// The version of dokku running on the host
+	Version semver.Version
+}
+
+func NewDokkuClient(executor Executor, version semver.Version) *DokkuClient {
+	return &DokkuClient{
+		Executor: executor,
+		Version:  version,
+	}
+}
+
+// The command for the operation on the host's version of dokku, see
+// dokkuCommands
+func (c *DokkuClient) Cmd(op dokkuOp) (string, error) {
+	return commandForVersion(op, c.Version)
+}
+
+// Whether the operation is available on the host's version of dokku
+func (c *DokkuClient) Supports(op dokkuOp) bool {
+	cmd, err := c.Cmd(op)
+	return err == nil && cmd != ""
+}
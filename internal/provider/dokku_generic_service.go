@@ -5,12 +5,13 @@ package provider
 //
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 type DokkuGenericServiceI interface {
@@ -102,8 +103,8 @@ func parseExposedPorts(exposedPorts string) ([]string, error) {
 	return result, nil
 }
 
-func dokkuServiceRead(service *DokkuGenericService, client *goph.Client) error {
-	serviceInfo, err := getServiceInfo(service.CmdName, service.Name, client)
+func dokkuServiceRead(ctx context.Context, service *DokkuGenericService, client *DokkuClient) error {
+	serviceInfo, err := getServiceInfo(ctx, service.CmdName, service.Name, client)
 
 	if err != nil {
 		return err
@@ -144,13 +145,12 @@ func dokkuServiceRead(service *DokkuGenericService, client *goph.Client) error {
 // Probably the way we want to go in the future is just using a lower level API
 // for extracting info from dokku. Adding this now allows us to re-use this
 // in `dokkuServiceRead` as well as in the clickhouse service resource.
-func getServiceInfo(service string, name string, client *goph.Client) (map[string]string, error) {
-	res := run(client, fmt.Sprintf("%s:info %s", service, name))
+func getServiceInfo(ctx context.Context, service string, name string, client *DokkuClient) (map[string]string, error) {
+	res := run(ctx, client, fmt.Sprintf("%s:info %s", service, name))
 
 	if res.err != nil {
-		if res.status > 0 {
+		if errors.Is(res.err, ErrNotFound) {
 			log.Printf("[DEBUG] %s service %s does not exist\n", service, name)
-			// return nil, err
 			return nil, nil
 		} else {
 			return nil, res.err
@@ -177,15 +177,15 @@ func (s *DokkuGenericService) buildExposedPortsString() string {
 	return strings.Join(s.Exposed, " ")
 }
 
-func dokkuServiceCreate(service *DokkuGenericService, client *goph.Client) error {
-	res := run(client, fmt.Sprintf("%s:create %s %s", service.CmdName, service.Name, createServiceFlagStr(service)))
+func dokkuServiceCreate(ctx context.Context, service *DokkuGenericService, client *DokkuClient) error {
+	res := run(ctx, client, fmt.Sprintf("%s:create %s %s", service.CmdName, service.Name, createServiceFlagStr(service)))
 
 	if res.err != nil {
 		return res.err
 	} else {
 		// Service was created, stop it if necessary
 		if service.Stopped {
-			res = run(client, fmt.Sprintf("%s:stop %s", service.CmdName, service.Name))
+			res = run(ctx, client, fmt.Sprintf("%s:stop %s", service.CmdName, service.Name))
 
 			if res.err != nil {
 				return res.err
@@ -199,18 +199,18 @@ func dokkuServiceCreate(service *DokkuGenericService, client *goph.Client) error
 		if len(service.Exposed) > 0 && !(len(service.Exposed) == 1 && service.Exposed[0] == "") {
 			log.Printf("[DEBUG] service.Exposed length %d", len(service.Exposed))
 			log.Print("[DEBUG] Setting expose...")
-			res = run(client, fmt.Sprintf("%s:expose %s %s", service.CmdName, service.Name, service.buildExposedPortsString()))
+			res = run(ctx, client, fmt.Sprintf("%s:expose %s %s", service.CmdName, service.Name, service.buildExposedPortsString()))
 			if res.err != nil {
 				return res.err
 			}
 		}
 
 		// Read the service to get info on image etc
-		return dokkuServiceRead(service, client)
+		return dokkuServiceRead(ctx, service, client)
 	}
 }
 
-func dokkuServiceUpdate(service *DokkuGenericService, d *schema.ResourceData, client *goph.Client) error {
+func dokkuServiceUpdate(ctx context.Context, service *DokkuGenericService, d *schema.ResourceData, client *DokkuClient) error {
 	serviceName := d.Get("name").(string)
 	oldServiceName := d.Get("name").(string)
 
@@ -233,13 +233,13 @@ func dokkuServiceUpdate(service *DokkuGenericService, d *schema.ResourceData, cl
 
 		log.Printf("[DEBUG] running dokku %s:clone %s -> %s\n", service.CmdName, oldServiceName, cloneServiceName)
 		createFlags := createServiceFlagStr(service)
-		res := run(client, fmt.Sprintf("%s:clone %s %s %s\n", service.CmdName, oldServiceName, cloneServiceName, createFlags))
+		res := run(ctx, client, fmt.Sprintf("%s:clone %s %s %s\n", service.CmdName, oldServiceName, cloneServiceName, createFlags))
 
 		if res.err != nil {
 			return res.err
 		}
 
-		err := dokkuServiceDestroy(service.CmdName, oldServiceName, client)
+		err := dokkuServiceDestroy(ctx, service.CmdName, oldServiceName, client)
 		if err != nil {
 			return err
 		}
@@ -247,13 +247,13 @@ func dokkuServiceUpdate(service *DokkuGenericService, d *schema.ResourceData, cl
 		if !d.HasChange("name") {
 			// Clone again to the original name
 			log.Printf("[DEBUG] running dokku %s:clone %s -> %s\n", service.CmdName, cloneServiceName, d.Get("name"))
-			res = run(client, fmt.Sprintf("%s:clone %s %s %s\n", service.CmdName, cloneServiceName, d.Get("name"), createFlags))
+			res = run(ctx, client, fmt.Sprintf("%s:clone %s %s %s\n", service.CmdName, cloneServiceName, d.Get("name"), createFlags))
 
 			if res.err != nil {
 				return res.err
 			}
 
-			err = dokkuServiceDestroy(service.CmdName, cloneServiceName, client)
+			err = dokkuServiceDestroy(ctx, service.CmdName, cloneServiceName, client)
 
 			if err != nil {
 				return err
@@ -270,7 +270,7 @@ func dokkuServiceUpdate(service *DokkuGenericService, d *schema.ResourceData, cl
 
 		log.Printf("[DEBUG] running `dokku %s`\n", updateStr)
 
-		res := run(client, updateStr)
+		res := run(ctx, client, updateStr)
 
 		if res.err != nil {
 			return res.err
@@ -280,9 +280,9 @@ func dokkuServiceUpdate(service *DokkuGenericService, d *schema.ResourceData, cl
 	if d.HasChange("stopped") {
 		var res SshOutput
 		if d.Get("stopped").(bool) {
-			res = run(client, fmt.Sprintf("%s:stop %s", service.CmdName, service.Name))
+			res = run(ctx, client, fmt.Sprintf("%s:stop %s", service.CmdName, service.Name))
 		} else {
-			res = run(client, fmt.Sprintf("%s:start %s", service.CmdName, service.Name))
+			res = run(ctx, client, fmt.Sprintf("%s:start %s", service.CmdName, service.Name))
 		}
 
 		if res.err != nil {
@@ -294,9 +294,9 @@ func dokkuServiceUpdate(service *DokkuGenericService, d *schema.ResourceData, cl
 		var res SshOutput
 		exposed := d.Get("expose_on").(string)
 		if exposed == "" {
-			res = run(client, fmt.Sprintf("%s:unexpose %s", service.CmdName, service.Name))
+			res = run(ctx, client, fmt.Sprintf("%s:unexpose %s", service.CmdName, service.Name))
 		} else {
-			res = run(client, fmt.Sprintf("%s:expose %s %s", service.CmdName, service.Name, exposed))
+			res = run(ctx, client, fmt.Sprintf("%s:expose %s %s", service.CmdName, service.Name, exposed))
 		}
 
 		if res.err != nil {
@@ -304,12 +304,12 @@ func dokkuServiceUpdate(service *DokkuGenericService, d *schema.ResourceData, cl
 		}
 	}
 
-	return dokkuServiceRead(service, client)
+	return dokkuServiceRead(ctx, service, client)
 }
 
-func dokkuServiceDestroy(cmd string, serviceName string, client *goph.Client) error {
+func dokkuServiceDestroy(ctx context.Context, cmd string, serviceName string, client *DokkuClient) error {
 	log.Printf("[DEBUG] running %s:destroy on %s\n", cmd, serviceName)
-	res := run(client, fmt.Sprintf("%s:destroy %s -f", cmd, serviceName))
+	res := run(ctx, client, fmt.Sprintf("%s:destroy %s -f", cmd, serviceName))
 
 	return res.err
 }
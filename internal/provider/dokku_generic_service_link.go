@@ -1,16 +1,17 @@
 package provider
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 //
-func serviceLinkCreate(d *schema.ResourceData, serviceName string, client *goph.Client) error {
+func serviceLinkCreate(ctx context.Context, d *schema.ResourceData, serviceName string, client *DokkuClient) error {
 	options := make([]string, 2)
 
 	if _, ok := d.GetOk("alias"); ok {
@@ -27,7 +28,7 @@ func serviceLinkCreate(d *schema.ResourceData, serviceName string, client *goph.
 
 	cmd := fmt.Sprintf("%s:link %s %s %s", serviceName, d.Get("service"), d.Get("app"), optionsCmd)
 	log.Printf("[DEBUG] running `%s`", cmd)
-	res := run(client, cmd)
+	res := run(ctx, client, cmd)
 
 	// TODO better error handling, e.g app already created
 	if res.err != nil {
@@ -46,16 +47,17 @@ func serviceLinkCreate(d *schema.ResourceData, serviceName string, client *goph.
 // thought: maybe we can get the alias from the app config?
 //
 // as such this function for now just assesses whether or not the link exists
-func serviceLinkRead(d *schema.ResourceData, serviceName string, client *goph.Client) error {
+func serviceLinkRead(ctx context.Context, d *schema.ResourceData, serviceName string, client *DokkuClient) error {
 	cmd := fmt.Sprintf("%s:linked %s %s", serviceName, d.Get("service"), d.Get("app"))
 	log.Println(fmt.Sprintf("[DEBUG] running `%s`", cmd))
-	res := run(client, cmd)
+	res := run(ctx, client, cmd)
 
 	d.SetId(fmt.Sprintf("%s-%s", d.Get("service").(string), d.Get("app").(string)))
 
 	if res.err != nil {
-		// TODO use stdout as extra verification?
-		if res.status > 0 {
+		// :linked exits 1 without a message when the link doesn't exist, and
+		// fails with "does not exist" if the service or app has gone
+		if errors.Is(res.err, ErrNotFound) || (res.status == 1 && strings.TrimSpace(res.stderr) == "") {
 			d.SetId("")
 			return nil
 		}
@@ -65,8 +67,8 @@ func serviceLinkRead(d *schema.ResourceData, serviceName string, client *goph.Cl
 }
 
 //
-func serviceLinkDelete(d *schema.ResourceData, serviceName string, client *goph.Client) error {
-	res := run(client, fmt.Sprintf("%s:unlink %s %s", serviceName, d.Get("service"), d.Get("app")))
+func serviceLinkDelete(ctx context.Context, d *schema.ResourceData, serviceName string, client *DokkuClient) error {
+	res := run(ctx, client, fmt.Sprintf("%s:unlink %s %s", serviceName, d.Get("service"), d.Get("app")))
 
 	if res.err == nil {
 		d.SetId("")
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestServiceLinkLifecycle(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	dokku.Exec("apps:create test-app")
+	dokku.Exec("redis:create test-redis")
+
+	d := schema.TestResourceDataRaw(t, resourceRedisServiceLink().Schema, map[string]interface{}{
+		"app":     "test-app",
+		"service": "test-redis",
+		"alias":   "CACHE",
+	})
+
+	if err := serviceLinkCreate(ctx, d, "redis", client); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+
+	if _, ok := dokku.apps["test-app"].config["CACHE_URL"]; !ok {
+		t.Errorf("expected link to set CACHE_URL")
+	}
+
+	if err := serviceLinkRead(ctx, d, "redis", client); err != nil || d.Id() == "" {
+		t.Fatalf("expected link to exist, got %v", err)
+	}
+
+	if err := serviceLinkDelete(ctx, d, "redis", client); err != nil {
+		t.Fatalf("unlink failed: %v", err)
+	}
+
+	d.SetId("test-redis-test-app")
+	if err := serviceLinkRead(ctx, d, "redis", client); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	if d.Id() != "" {
+		t.Errorf("expected unlinked service to be removed from state")
+	}
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestServiceLifecycle(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	service := &DokkuGenericService{
+		Name:         "test-db",
+		Image:        "postgres",
+		ImageVersion: "16.4",
+		Stopped:      true,
+		Exposed:      []string{"0.0.0.0:8585"},
+		CmdName:      "postgres",
+	}
+
+	if err := dokkuServiceCreate(ctx, service, client); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	read := &DokkuGenericService{Name: "test-db", CmdName: "postgres"}
+	if err := dokkuServiceRead(ctx, read, client); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	if read.Id != "test-db" || !read.Stopped {
+		t.Errorf("expected a stopped service, got %+v", read)
+	}
+
+	if !reflect.DeepEqual(read.Exposed, []string{"0.0.0.0:8585"}) {
+		t.Errorf("unexpected exposed ports %v", read.Exposed)
+	}
+
+	if stored := dokku.services["postgres"]["test-db"]; stored.image != "postgres" || stored.imageVersion != "16.4" {
+		t.Errorf("unexpected image %s:%s", stored.image, stored.imageVersion)
+	}
+
+	if err := dokkuServiceDestroy(ctx, "postgres", "test-db", client); err != nil {
+		t.Fatalf("destroy failed: %v", err)
+	}
+
+	info, err := getServiceInfo(ctx, "postgres", "test-db", client)
+	if err != nil || info != nil {
+		t.Errorf("expected service to be gone, got %v, %v", info, err)
+	}
+}
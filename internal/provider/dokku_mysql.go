@@ -1,10 +1,10 @@
 package provider
 
 import (
+	"context"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 type DokkuMysqlService struct {
@@ -33,18 +33,18 @@ func NewMysqlServiceFromResourceData(d *schema.ResourceData) *DokkuMysqlService
 	}
 }
 
-func dokkuMysqlRead(mysql *DokkuMysqlService, client *goph.Client) error {
-	return dokkuServiceRead(&mysql.DokkuGenericService, client)
+func dokkuMysqlRead(ctx context.Context, mysql *DokkuMysqlService, client *DokkuClient) error {
+	return dokkuServiceRead(ctx, &mysql.DokkuGenericService, client)
 }
 
-func dokkuMysqlCreate(mysql *DokkuMysqlService, client *goph.Client) error {
-	return dokkuServiceCreate(&mysql.DokkuGenericService, client)
+func dokkuMysqlCreate(ctx context.Context, mysql *DokkuMysqlService, client *DokkuClient) error {
+	return dokkuServiceCreate(ctx, &mysql.DokkuGenericService, client)
 }
 
-func dokkuMysqlUpdate(mysql *DokkuMysqlService, d *schema.ResourceData, client *goph.Client) error {
-	return dokkuServiceUpdate(&mysql.DokkuGenericService, d, client)
+func dokkuMysqlUpdate(ctx context.Context, mysql *DokkuMysqlService, d *schema.ResourceData, client *DokkuClient) error {
+	return dokkuServiceUpdate(ctx, &mysql.DokkuGenericService, d, client)
 }
 
-func dokkuMysqlDestroy(mysql *DokkuMysqlService, client *goph.Client) error {
-	return dokkuServiceDestroy(mysql.CmdName, mysql.Name, client)
+func dokkuMysqlDestroy(ctx context.Context, mysql *DokkuMysqlService, client *DokkuClient) error {
+	return dokkuServiceDestroy(ctx, mysql.CmdName, mysql.Name, client)
 }
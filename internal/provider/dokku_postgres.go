@@ -1,10 +1,10 @@
 package provider
 
 import (
+	"context"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 type DokkuPostgresService struct {
@@ -37,18 +37,18 @@ func NewDokkuPostgresServiceFromResourceData(d *schema.ResourceData) *DokkuPostg
 	}
 }
 
-func dokkuPgRead(pg *DokkuPostgresService, client *goph.Client) error {
-	return dokkuServiceRead(&pg.DokkuGenericService, client)
+func dokkuPgRead(ctx context.Context, pg *DokkuPostgresService, client *DokkuClient) error {
+	return dokkuServiceRead(ctx, &pg.DokkuGenericService, client)
 }
 
-func dokkuPgCreate(pg *DokkuPostgresService, client *goph.Client) error {
-	return dokkuServiceCreate(&pg.DokkuGenericService, client)
+func dokkuPgCreate(ctx context.Context, pg *DokkuPostgresService, client *DokkuClient) error {
+	return dokkuServiceCreate(ctx, &pg.DokkuGenericService, client)
 }
 
-func dokkuPgUpdate(pg *DokkuPostgresService, d *schema.ResourceData, client *goph.Client) error {
-	return dokkuServiceUpdate(&pg.DokkuGenericService, d, client)
+func dokkuPgUpdate(ctx context.Context, pg *DokkuPostgresService, d *schema.ResourceData, client *DokkuClient) error {
+	return dokkuServiceUpdate(ctx, &pg.DokkuGenericService, d, client)
 }
 
-func dokkuPgDestroy(pg *DokkuPostgresService, client *goph.Client) error {
-	return dokkuServiceDestroy(pg.CmdName, pg.Name, client)
+func dokkuPgDestroy(ctx context.Context, pg *DokkuPostgresService, client *DokkuClient) error {
+	return dokkuServiceDestroy(ctx, pg.CmdName, pg.Name, client)
 }
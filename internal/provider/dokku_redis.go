@@ -1,10 +1,10 @@
 package provider
 
 import (
+	"context"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 type DokkuRedisService struct {
@@ -43,18 +43,18 @@ func NewDokkuRedisServiceFromResourceData(d *schema.ResourceData) *DokkuRedisSer
 	}
 }
 
-func dokkuRedisRead(redis *DokkuRedisService, client *goph.Client) error {
-	return dokkuServiceRead(&redis.DokkuGenericService, client)
+func dokkuRedisRead(ctx context.Context, redis *DokkuRedisService, client *DokkuClient) error {
+	return dokkuServiceRead(ctx, &redis.DokkuGenericService, client)
 }
 
-func dokkuRedisCreate(redis *DokkuRedisService, client *goph.Client) error {
-	return dokkuServiceCreate(&redis.DokkuGenericService, client)
+func dokkuRedisCreate(ctx context.Context, redis *DokkuRedisService, client *DokkuClient) error {
+	return dokkuServiceCreate(ctx, &redis.DokkuGenericService, client)
 }
 
-func dokkuRedisUpdate(redis *DokkuRedisService, d *schema.ResourceData, client *goph.Client) error {
-	return dokkuServiceUpdate(&redis.DokkuGenericService, d, client)
+func dokkuRedisUpdate(ctx context.Context, redis *DokkuRedisService, d *schema.ResourceData, client *DokkuClient) error {
+	return dokkuServiceUpdate(ctx, &redis.DokkuGenericService, d, client)
 }
 
-func dokkuRedisDestroy(redis *DokkuRedisService, client *goph.Client) error {
-	return dokkuServiceDestroy(redis.CmdName, redis.Name, client)
+func dokkuRedisDestroy(ctx context.Context, redis *DokkuRedisService, client *DokkuClient) error {
+	return dokkuServiceDestroy(ctx, redis.CmdName, redis.Name, client)
 }
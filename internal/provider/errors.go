@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// The kinds of failure resources need to tell apart. Use errors.Is to check
+// for these, e.g errors.Is(res.err, ErrNotFound)
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrPluginNotInstalled = errors.New("plugin not installed")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrLockHeld           = errors.New("lock held")
+	ErrTransport          = errors.New("transport error")
+)
+
+// DokkuError is returned by run when a command fails, carrying what dokku
+// printed so that resources can give useful diagnostics.
+type DokkuError struct {
+	// The command that was run, with sensitive strings removed
+	Cmd string
+
+	// Exit status of the command, 0 for transport errors as the command's
+	// status is unknown
+	Status int
+
+	Stdout string
+	Stderr string
+
+	// What kind of failure this is, one of the Err* sentinels above, or nil
+	// if it couldn't be classified
+	Kind error
+
+	// The underlying error from the executor
+	Err error
+}
+
+func (e *DokkuError) Error() string {
+	if e.Kind == ErrTransport {
+		return fmt.Sprintf("Error running `%s`: %v", e.Cmd, e.Err)
+	}
+
+	return fmt.Sprintf("Error [%d] running `%s`: %s", e.Status, e.Cmd, e.Message())
+}
+
+// The message dokku gave for the failure. Dokku writes errors to stderr, but
+// fall back to stdout for commands that don't.
+func (e *DokkuError) Message() string {
+	msg := strings.TrimSpace(e.Stderr)
+	if msg == "" {
+		msg = strings.TrimSpace(e.Stdout)
+	}
+
+	// Strip dokku's " !     " prefix from each line
+	return dokkuLogPrefix.ReplaceAllString(msg, "")
+}
+
+func (e *DokkuError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+func (e *DokkuError) Unwrap() error {
+	return e.Err
+}
+
+var dokkuLogPrefix = regexp.MustCompile(`(?m)^\s*!\s+`)
+
+// Patterns in dokku's (and its plugins') output for each kind of failure. These
+// are checked in order, so more specific kinds come first.
+var dokkuErrorPatterns = []struct {
+	kind    error
+	pattern *regexp.Regexp
+}{
+	{ErrPluginNotInstalled, regexp.MustCompile(`(?i)is not a dokku command|command not found`)},
+	{ErrPermissionDenied, regexp.MustCompile(`(?i)permission denied|a password is required|not allowed to execute`)},
+	{ErrLockHeld, regexp.MustCompile(`(?i)currently being deployed|is locked|deploy lock`)},
+	{ErrAlreadyExists, regexp.MustCompile(`(?i)already exists|already taken`)},
+	{ErrNotFound, regexp.MustCompile(`(?i)does not exist|not found`)},
+}
+
+// Work out what kind of failure a command's output describes. The exit status
+// of a missing command (127) is checked as well, as the shell's message for it
+// varies.
+func classifyDokkuError(status int, stdout string, stderr string) error {
+	if status == 127 {
+		return ErrPluginNotInstalled
+	}
+
+	output := stderr + "\n" + stdout
+	for _, p := range dokkuErrorPatterns {
+		if p.pattern.MatchString(output) {
+			return p.kind
+		}
+	}
+
+	return nil
+}
+
+// Hints added to the diagnostic for each kind of failure
+var dokkuErrorHints = map[error]string{
+	ErrAlreadyExists:      "It may have been created outside of terraform, in which case it can be imported with `terraform import`.",
+	ErrPluginNotInstalled: "Check the dokku plugin providing this command is installed on the host.",
+	ErrPermissionDenied:   "Check the user the provider connects as is allowed to run dokku commands.",
+	ErrLockHeld:           "The app is locked, or another deploy is in progress. Try again once it has finished, or unlock the app with `dokku apps:unlock`.",
+	ErrTransport:          "The dokku host could not be reached, check the connection settings and that the host is up.",
+}
+
+// Convert an error from run into diagnostics, with a hint on how to fix it
+// where we know the kind of failure.
+func dokkuDiag(err error) diag.Diagnostics {
+	var dokkuErr *DokkuError
+	if !errors.As(err, &dokkuErr) {
+		return diag.FromErr(err)
+	}
+
+	return diag.Diagnostics{
+		diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  dokkuErr.Error(),
+			Detail:   dokkuErrorHints[dokkuErr.Kind],
+		},
+	}
+}
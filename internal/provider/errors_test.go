@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClassifyDokkuError(t *testing.T) {
+	cases := []struct {
+		status int
+		stderr string
+		kind   error
+	}{
+		{1, " !     App foo does not exist", ErrNotFound},
+		{1, " !     Postgres service foo does not exist", ErrNotFound},
+		{1, " !     Name is already taken", ErrAlreadyExists},
+		{1, " !     Postgres service foo already exists", ErrAlreadyExists},
+		{1, " !     `postgres:info` is not a dokku command.", ErrPluginNotInstalled},
+		{127, "sh: 1: dokku: not found", ErrPluginNotInstalled},
+		{1, "sudo: a password is required", ErrPermissionDenied},
+		{1, " !     app foo is currently being deployed or locked. Waiting...", ErrLockHeld},
+		{1, " !     Something else went wrong", nil},
+	}
+
+	for _, c := range cases {
+		kind := classifyDokkuError(c.status, "", c.stderr)
+		if kind != c.kind {
+			t.Errorf("%q: expected %v, got %v", c.stderr, c.kind, kind)
+		}
+	}
+}
+
+func TestRunReturnsDokkuError(t *testing.T) {
+	res := run(context.Background(), NewLocalExecutor(), "echo some output; echo ' !     App foo does not exist' >&2; exit 1")
+
+	if res.status != 1 {
+		t.Fatalf("expected status 1, got %d", res.status)
+	}
+
+	if res.stdout != "some output\n" {
+		t.Errorf("expected stdout to not include stderr, got %q", res.stdout)
+	}
+
+	if !errors.Is(res.err, ErrNotFound) {
+		t.Errorf("expected a not found error, got %v", res.err)
+	}
+
+	var dokkuErr *DokkuError
+	if !errors.As(res.err, &dokkuErr) || dokkuErr.Message() != "App foo does not exist" {
+		t.Errorf("expected the message from stderr, got %v", res.err)
+	}
+}
@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// Executor runs dokku commands against the host, returning the stdout and
+// stderr of the command separately. stdin is optional, and is streamed to the
+// command when set (e.g certs:add reads a tarball from it). Failures of the
+// command itself are returned as an error carrying the exit status (see
+// exitStatus), anything else is treated as a transport error.
+//
+// Resources only ever see an Executor (via DokkuClient), so they work the same
+// regardless of how the provider reaches dokku.
+type Executor interface {
+	Run(ctx context.Context, cmd string, stdin io.Reader) (stdout []byte, stderr []byte, err error)
+}
+
+// LocalExecutor runs commands directly on the machine terraform is running on,
+// for when that's the Dokku server itself. It's combined with a "dokku" prefix
+// (see withCommandPrefix) by the provider, and the user running terraform needs
+// to be able to run dokku (i.e root, or the dokku user) unless using sudo.
+type LocalExecutor struct{}
+
+func NewLocalExecutor() *LocalExecutor {
+	return &LocalExecutor{}
+}
+
+// Commands are run through a shell, as they are over SSH, as the arguments
+// may have been quoted for it (e.g config values)
+func (e *LocalExecutor) Run(ctx context.Context, cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	c := exec.CommandContext(ctx, "sh", "-c", cmd)
+	c.Stdin = stdin
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+
+	// When the context is done, kill everything the command started rather
+	// than just the shell, and don't wait long for anything that's left to
+	// let go of its output
+	killProcessGroupOnCancel(c)
+	c.WaitDelay = time.Second
+
+	err := c.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// Prefixes every command run by the wrapped executor, e.g with `sudo -n dokku`
+// for SSH users that don't have dokku as their forced command.
+type prefixedExecutor struct {
+	Executor
+	prefix string
+}
+
+func withCommandPrefix(e Executor, prefix string) Executor {
+	return &prefixedExecutor{Executor: e, prefix: prefix}
+}
+
+func (e *prefixedExecutor) Run(ctx context.Context, cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	return e.Executor.Run(ctx, e.prefix+" "+cmd, stdin)
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Records the commands run, and the stdin they were given
+type recordingExecutor struct {
+	cmds  []string
+	stdin []string
+}
+
+func (e *recordingExecutor) Run(ctx context.Context, cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	e.cmds = append(e.cmds, cmd)
+	if stdin != nil {
+		b, _ := io.ReadAll(stdin)
+		e.stdin = append(e.stdin, string(b))
+	}
+	return nil, nil, nil
+}
+
+func TestWithCommandPrefix(t *testing.T) {
+	recorder := &recordingExecutor{}
+	client := withCommandPrefix(recorder, "sudo -n dokku")
+
+	if _, _, err := client.Run(context.Background(), "apps:create test-app", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.Run(context.Background(), "certs:add test-app", strings.NewReader("tarball")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"sudo -n dokku apps:create test-app", "sudo -n dokku certs:add test-app"}
+	if strings.Join(recorder.cmds, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected commands %q, got %q", expected, recorder.cmds)
+	}
+	if len(recorder.stdin) != 1 || recorder.stdin[0] != "tarball" {
+		t.Errorf("expected stdin to be passed through, got %q", recorder.stdin)
+	}
+}
+
+func TestLocalExecutor(t *testing.T) {
+	client := NewLocalExecutor()
+
+	stdout, stderr, err := client.Run(context.Background(), "cat; echo err >&2", strings.NewReader("from stdin"))
+	if err != nil {
+		t.Fatalf("command failed: %v", err)
+	}
+	if string(stdout) != "from stdin" {
+		t.Errorf("expected stdin to be piped to the command, got %q", stdout)
+	}
+	if string(stderr) != "err\n" {
+		t.Errorf("expected stderr to be kept separate, got %q", stderr)
+	}
+
+	// Commands are killed when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, _, err := client.Run(ctx, "sleep 10", nil); err == nil {
+		t.Errorf("expected the command to be killed")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be killed when the context was done, took %v", elapsed)
+	}
+}
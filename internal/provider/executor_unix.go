@@ -0,0 +1,17 @@
+//go:build !windows
+
+package provider
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Run the command in its own process group, which is killed as a whole when
+// the command is cancelled
+func killProcessGroupOnCancel(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+}
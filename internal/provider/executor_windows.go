@@ -0,0 +1,8 @@
+//go:build windows
+
+package provider
+
+import "os/exec"
+
+// On Windows only the command itself is killed when it is cancelled
+func killProcessGroupOnCancel(c *exec.Cmd) {}
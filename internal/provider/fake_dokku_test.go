@@ -0,0 +1,1963 @@
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeDokku emulates the dokku commands used by the provider, keeping its
+// state in memory. It's served over SSH by fakeDokkuServer so the provider can
+// be tested end to end (including the resource.Test suites) without a real
+// dokku host.
+//
+// Output is formatted as dokku formats it, as far as the provider's parsers
+// are concerned. When adding support for a new dokku command to the provider,
+// add it here too.
+type fakeDokku struct {
+	mu sync.Mutex
+
+	version  string
+	apps     map[string]*fakeDokkuApp
+	services map[string]map[string]*fakeDokkuService
+	// storage directory name -> the --chown preset it was created with
+	storage map[string]string
+	// whether letsencrypt:cron-job --add has been run
+	letsencryptCron bool
+	// the command being run, and its stdin
+	command string
+	stdin   []byte
+	// when set, commands wait for it to be closed before running, to emulate
+	// ones that take a while (e.g a deploy), with held counting them
+	hold chan struct{}
+	held int32
+	// command -> the message it fails with, to emulate dokku erroring
+	failing map[string]string
+	// the commands run, e.g apps:exists
+	commands []string
+}
+
+type fakeDokkuApp struct {
+	locked     bool
+	config     map[string]string
+	domains    []string
+	buildpacks []string
+	// "plugin property" (e.g "builder-dockerfile dockerfile-path") -> value
+	builder map[string]string
+	// scheme:host:container
+	ports []string
+	nginx map[string]string
+	// set by proxy:set, empty for the global type (nginx)
+	proxyType     string
+	proxyDisabled bool
+	// whether the app has been deployed, nothing in the fake deploys apps but
+	// tests can set this to emulate it
+	deployed bool
+	scale    map[string]int
+	// how many times proxy:build-config has been run
+	proxyBuilds int
+	// process type -> "limit"/"reserve" -> resource type -> value
+	resources map[string]map[string]map[string]string
+	// phase -> options
+	dockerOptions map[string][]string
+	// letsencrypt:set properties, and the expiry of the certificate issued by
+	// letsencrypt:enable (empty when letsencrypt isn't enabled)
+	letsencrypt       map[string]string
+	letsencryptExpiry string
+	// added by certs:add
+	cert *x509.Certificate
+	// process types with checks disabled/skipped, and checks:set properties
+	// (only wait-to-retire)
+	checksDisabled []string
+	checksSkipped  []string
+	checks         map[string]string
+	// the commit made by the last deploy, and the image deployed (if any)
+	gitSha      string
+	sourceImage string
+	deploys     int
+	// path -> content of the files in the tarball deployed by tar:in
+	source map[string][]byte
+}
+
+type fakeDokkuService struct {
+	image        string
+	imageVersion string
+	stopped      bool
+	exposed      []string
+	// app name -> alias
+	links map[string]string
+}
+
+// The service plugins emulated, and their defaults
+type fakeDokkuPlugin struct {
+	title        string
+	image        string
+	imageVersion string
+	port         int
+	alias        string
+	scheme       string
+}
+
+var fakeDokkuPlugins = map[string]fakeDokkuPlugin{
+	"postgres":   {"Postgres", "postgres", "17.2", 5432, "DATABASE", "postgres"},
+	"mysql":      {"Mysql", "mysql", "8.4.3", 3306, "DATABASE", "mysql"},
+	"redis":      {"Redis", "redis", "7.4.1", 6379, "REDIS", "redis"},
+	"clickhouse": {"Clickhouse", "clickhouse/clickhouse-server", "24.11", 9000, "CLICKHOUSE", "clickhouse"},
+}
+
+// The nginx properties shown by nginx:report, in the order dokku shows them
+var fakeDokkuNginxProperties = []string{
+	"access-log-format",
+	"access-log-path",
+	"bind-address-ipv4",
+	"bind-address-ipv6",
+	"client-max-body-size",
+	"disable-custom-config",
+	"error-log-path",
+	"hsts-include-subdomains",
+	"hsts-max-age",
+	"hsts-preload",
+	"hsts",
+	"nginx-conf-sigil-path",
+	"proxy-buffer-size",
+	"proxy-buffering",
+	"proxy-buffers",
+	"proxy-busy-buffers-size",
+	"proxy-read-timeout",
+	"x-forwarded-for-value",
+	"x-forwarded-port-value",
+	"x-forwarded-proto-value",
+	"x-forwarded-ssl",
+}
+
+// The properties of the builder plugins, by plugin
+var fakeDokkuBuilderProperties = map[string][]string{
+	"builder":            {"build-dir", "selected"},
+	"builder-dockerfile": {"dockerfile-path"},
+	"builder-nixpacks":   {"nixpackstoml-path"},
+	"builder-pack":       {"projecttoml-path"},
+}
+
+// The resource types shown by resource:report
+var fakeDokkuResourceTypes = []string{
+	"cpu",
+	"memory",
+	"memory-swap",
+	"network",
+	"network-ingress",
+	"network-egress",
+	"nvidia-gpu",
+}
+
+type fakeDokkuResult struct {
+	stdout string
+	stderr string
+	status int
+}
+
+type fakeDokkuCommand func(f *fakeDokku, args []string) fakeDokkuResult
+
+func newFakeDokku(version string) *fakeDokku {
+	return &fakeDokku{
+		version:  version,
+		apps:     make(map[string]*fakeDokkuApp),
+		services: make(map[string]map[string]*fakeDokkuService),
+		storage:  make(map[string]string),
+	}
+}
+
+// Run a command as dokku would, given the command line as sent over SSH. The
+// command may be prefixed with `dokku` or `sudo -n dokku` (see use_sudo).
+func (f *fakeDokku) Exec(cmdLine string) fakeDokkuResult {
+	return f.ExecWithStdin(cmdLine, nil)
+}
+
+// As Exec, with stdin available to the command as f.stdin
+func (f *fakeDokku) ExecWithStdin(cmdLine string, stdin []byte) fakeDokkuResult {
+	args, err := splitShellWords(cmdLine)
+	if err != nil {
+		return fakeDokkuFail("invalid command line: %v", err)
+	}
+
+	if len(args) > 0 && args[0] == "sudo" {
+		args = args[1:]
+		if len(args) > 0 && args[0] == "-n" {
+			args = args[1:]
+		}
+	}
+	if len(args) > 0 && args[0] == "dokku" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return fakeDokkuFail("no command given")
+	}
+
+	if f.hold != nil {
+		atomic.AddInt32(&f.held, 1)
+		<-f.hold
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.command, f.stdin = args[0], stdin
+	f.commands = append(f.commands, args[0])
+	defer func() { f.command, f.stdin = "", nil }()
+
+	if msg, ok := f.failing[args[0]]; ok {
+		return fakeDokkuFail("%s", msg)
+	}
+
+	if cmd, ok := fakeDokkuCommands[args[0]]; ok {
+		return cmd(f, args[1:])
+	}
+
+	if plugin, subcommand, ok := strings.Cut(args[0], ":"); ok {
+		if _, ok := fakeDokkuPlugins[plugin]; ok {
+			if cmd, ok := fakeDokkuServiceCommands[subcommand]; ok {
+				return cmd(f, plugin, args[1:])
+			}
+		}
+	}
+
+	return fakeDokkuFail("`%s` is not a dokku command.", args[0])
+}
+
+func fakeDokkuOk(lines ...string) fakeDokkuResult {
+	if len(lines) == 0 {
+		return fakeDokkuResult{}
+	}
+	return fakeDokkuResult{stdout: strings.Join(lines, "\n") + "\n"}
+}
+
+// Fail in the way dokku_log_fail does
+func fakeDokkuFail(format string, a ...interface{}) fakeDokkuResult {
+	return fakeDokkuResult{
+		stderr: fmt.Sprintf(" !     %s\n", fmt.Sprintf(format, a...)),
+		status: 1,
+	}
+}
+
+// Format key/values as dokku's reports do
+func fakeDokkuReport(title string, keys []string, values map[string]string) fakeDokkuResult {
+	lines := []string{fmt.Sprintf("=====> %s", title)}
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("       %-40s %s", k+":", values[k]))
+	}
+	return fakeDokkuOk(lines...)
+}
+
+// checks:enable, checks:disable & checks:skip, which take a comma separated
+// list of process types. A process type is only ever disabled or skipped.
+func fakeDokkuChecksToggle(f *fakeDokku, args []string) fakeDokkuResult {
+	app, _, fail := f.app(args)
+	if fail != nil {
+		return *fail
+	}
+	processTypes := []string{"_all_"}
+	if len(args) > 1 {
+		processTypes = strings.Split(args[1], ",")
+	}
+
+	for _, processType := range processTypes {
+		app.checksDisabled = fakeDokkuRemove(app.checksDisabled, processType)
+		app.checksSkipped = fakeDokkuRemove(app.checksSkipped, processType)
+	}
+
+	switch f.command {
+	case "checks:disable":
+		app.checksDisabled = append(app.checksDisabled, processTypes...)
+	case "checks:skip":
+		app.checksSkipped = append(app.checksSkipped, processTypes...)
+	}
+
+	return fakeDokkuOk()
+}
+
+// Emulate a commit to the app's repository, with a made up sha
+func (f *fakeDokku) commit(app *fakeDokkuApp, name string) {
+	app.deploys++
+	app.gitSha = fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%s-%d", name, app.deploys))))
+}
+
+// Emulate a deploy, starting a web process if nothing is scaled up
+func (f *fakeDokku) deploy(app *fakeDokkuApp) {
+	app.deployed = true
+
+	if len(app.scale) == 0 {
+		app.scale["web"] = 1
+	}
+}
+
+// certs:add & certs:update, which read a tarball of server.crt and server.key
+// from stdin
+func fakeDokkuCertsAdd(f *fakeDokku, args []string) fakeDokkuResult {
+	app, _, fail := f.app(args)
+	if fail != nil {
+		return *fail
+	}
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(bytes.NewReader(f.stdin))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fakeDokkuFail("Tar archive is invalid: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return fakeDokkuFail("Tar archive is invalid: %v", err)
+		}
+		files[header.Name] = content
+	}
+
+	block, _ := pem.Decode(files["server.crt"])
+	if block == nil || files["server.key"] == nil {
+		return fakeDokkuFail("Tar archive missing .crt or .key")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fakeDokkuFail("Invalid certificate: %v", err)
+	}
+
+	app.cert = cert
+	return fakeDokkuOk("-----> Adding certificate")
+}
+
+// Split positional arguments from --flags. Flags take a value unless listed
+// in boolFlags.
+func fakeDokkuFlags(args []string, boolFlags ...string) ([]string, map[string]string) {
+	isBool := sliceToLookupMap(boolFlags)
+	positional := []string{}
+	flags := make(map[string]string)
+
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			positional = append(positional, args[i])
+			continue
+		}
+
+		if _, ok := isBool[args[i]]; ok || i+1 >= len(args) {
+			flags[args[i]] = ""
+			continue
+		}
+
+		flags[args[i]] = args[i+1]
+		i++
+	}
+
+	return positional, flags
+}
+
+func (f *fakeDokku) app(args []string) (*fakeDokkuApp, string, *fakeDokkuResult) {
+	if len(args) == 0 {
+		res := fakeDokkuFail("Please specify an app to run the command on")
+		return nil, "", &res
+	}
+
+	app, ok := f.apps[args[0]]
+	if !ok {
+		res := fakeDokkuFail("App %s does not exist", args[0])
+		return nil, args[0], &res
+	}
+
+	return app, args[0], nil
+}
+
+var fakeDokkuCommands map[string]fakeDokkuCommand
+
+func init() {
+	fakeDokkuCommands = map[string]fakeDokkuCommand{
+		"version": func(f *fakeDokku, args []string) fakeDokkuResult {
+			return fakeDokkuOk(fmt.Sprintf("dokku version %s", f.version))
+		},
+
+		"apps:create": func(f *fakeDokku, args []string) fakeDokkuResult {
+			if len(args) == 0 {
+				return fakeDokkuFail("Please specify an app to run the command on")
+			}
+			if _, ok := f.apps[args[0]]; ok {
+				return fakeDokkuFail("Name is already taken")
+			}
+			f.apps[args[0]] = &fakeDokkuApp{
+				config:  make(map[string]string),
+				builder: make(map[string]string),
+				nginx:   make(map[string]string),
+				scale:   make(map[string]int),
+
+				resources:   make(map[string]map[string]map[string]string),
+				letsencrypt: make(map[string]string),
+				checks:      make(map[string]string),
+				dockerOptions: map[string][]string{
+					"deploy": {"--restart=on-failure:10"},
+				},
+			}
+			return fakeDokkuOk(fmt.Sprintf("-----> Creating %s...", args[0]))
+		},
+
+		"apps:exists": func(f *fakeDokku, args []string) fakeDokkuResult {
+			if _, _, fail := f.app(args); fail != nil {
+				return *fail
+			}
+			return fakeDokkuOk()
+		},
+
+		"apps:destroy": func(f *fakeDokku, args []string) fakeDokkuResult {
+			_, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			for _, services := range f.services {
+				for _, s := range services {
+					delete(s.links, name)
+				}
+			}
+			delete(f.apps, name)
+			return fakeDokkuOk(fmt.Sprintf("-----> Destroying %s (including all add-ons)", name))
+		},
+
+		"apps:rename": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 2 {
+				return fakeDokkuFail("Please specify a new app name")
+			}
+			if _, ok := f.apps[args[1]]; ok {
+				return fakeDokkuFail("Name is already taken")
+			}
+			delete(f.apps, name)
+			f.apps[args[1]] = app
+			return fakeDokkuOk(fmt.Sprintf("-----> Renaming %s to %s... done", name, args[1]))
+		},
+
+		"apps:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s app information", name),
+				[]string{"App created at", "App deploy source", "App deploy source metadata", "App dir", "App locked"},
+				map[string]string{
+					"App created at": "1729238400",
+					"App dir":        fmt.Sprintf("/home/dokku/%s", name),
+					"App locked":     strconv.FormatBool(app.locked),
+				})
+		},
+
+		"apps:lock": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			app.locked = true
+			return fakeDokkuOk(fmt.Sprintf("-----> Deploy lock created for %s", name))
+		},
+
+		"apps:unlock": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			app.locked = false
+			return fakeDokkuOk(fmt.Sprintf("-----> Deploy lock removed for %s", name))
+		},
+
+		"config:show": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			keys := sortedKeys(app.config)
+			width := 0
+			for _, k := range keys {
+				if len(k) > width {
+					width = len(k)
+				}
+			}
+			lines := []string{fmt.Sprintf("=====> %s env vars", name)}
+			for _, k := range keys {
+				lines = append(lines, fmt.Sprintf("%-*s  %s", width+1, k+":", app.config[k]))
+			}
+			return fakeDokkuOk(lines...)
+		},
+
+		"config:get": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 2 {
+				return fakeDokkuFail("Expects a key")
+			}
+			val, ok := app.config[args[1]]
+			if !ok {
+				return fakeDokkuResult{status: 1}
+			}
+			return fakeDokkuOk(val)
+		},
+
+		"config:set": func(f *fakeDokku, args []string) fakeDokkuResult {
+			args, _ = fakeDokkuFlags(args, "--no-restart", "--encoded")
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			for _, kv := range args[1:] {
+				k, v, ok := strings.Cut(kv, "=")
+				if !ok {
+					return fakeDokkuFail("Invalid env pair: %s", kv)
+				}
+				app.config[k] = v
+			}
+			return fakeDokkuOk("-----> Setting config vars")
+		},
+
+		"config:unset": func(f *fakeDokku, args []string) fakeDokkuResult {
+			args, _ = fakeDokkuFlags(args, "--no-restart")
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			for _, k := range args[1:] {
+				delete(app.config, k)
+			}
+			return fakeDokkuOk("-----> Unsetting config vars")
+		},
+
+		"domains:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s domains information", name),
+				[]string{"Domains app enabled", "Domains app vhosts", "Domains global enabled", "Domains global vhosts"},
+				map[string]string{
+					"Domains app enabled":    strconv.FormatBool(len(app.domains) > 0),
+					"Domains app vhosts":     strings.Join(app.domains, " "),
+					"Domains global enabled": "false",
+				})
+		},
+
+		"domains:set": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			app.domains = append([]string{}, args[1:]...)
+			return fakeDokkuOk("-----> Setting domains")
+		},
+
+		"domains:add": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			for _, d := range args[1:] {
+				if _, ok := sliceToLookupMap(app.domains)[d]; !ok {
+					app.domains = append(app.domains, d)
+				}
+			}
+			return fakeDokkuOk("-----> Added domains")
+		},
+
+		"domains:remove": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			app.domains = fakeDokkuRemove(app.domains, args[1:]...)
+			return fakeDokkuOk("-----> Removed domains")
+		},
+
+		"buildpacks:list": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			return fakeDokkuOk(append([]string{fmt.Sprintf("=====> %s buildpack urls", name)}, app.buildpacks...)...)
+		},
+
+		"buildpacks:add": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 2 {
+				return fakeDokkuFail("Must specify a buildpack to add")
+			}
+			app.buildpacks = append(app.buildpacks, args[1])
+			return fakeDokkuOk()
+		},
+
+		"buildpacks:clear": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			app.buildpacks = nil
+			return fakeDokkuOk()
+		},
+
+		"ports:list": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(app.ports) == 0 {
+				return fakeDokkuFail("No port mappings configured for app")
+			}
+			lines := []string{
+				fmt.Sprintf("=====> %s ports", name),
+				fmt.Sprintf("-----> %-25s %-25s %s", "scheme", "host port", "container port"),
+			}
+			for _, p := range app.ports {
+				parts := strings.Split(p, ":")
+				lines = append(lines, fmt.Sprintf("%-25s %-25s %s", parts[0], parts[1], parts[2]))
+			}
+			return fakeDokkuOk(lines...)
+		},
+
+		"ports:add": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			for _, p := range args[1:] {
+				if len(strings.Split(p, ":")) != 3 {
+					return fakeDokkuFail("Invalid port mapping: %s", p)
+				}
+				if _, ok := sliceToLookupMap(app.ports)[p]; !ok {
+					app.ports = append(app.ports, p)
+				}
+			}
+			return fakeDokkuOk("-----> Updating ports")
+		},
+
+		"ports:remove": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			app.ports = fakeDokkuRemove(app.ports, args[1:]...)
+			return fakeDokkuOk("-----> Updating ports")
+		},
+
+		"ps:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			running := "false"
+			for _, count := range app.scale {
+				if app.deployed && count > 0 {
+					running = "true"
+				}
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s ps information", name),
+				[]string{"Deployed", "Processes", "Ps can scale", "Ps restart policy", "Restore", "Running"},
+				map[string]string{
+					"Deployed":          strconv.FormatBool(app.deployed),
+					"Processes":         "0",
+					"Ps can scale":      "true",
+					"Ps restart policy": "on-failure:10",
+					"Restore":           "true",
+					"Running":           running,
+				})
+		},
+
+		"ps:scale": func(f *fakeDokku, args []string) fakeDokkuResult {
+			args, flags := fakeDokkuFlags(args, "--skip-deploy")
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+
+			if len(args) == 1 {
+				lines := []string{
+					fmt.Sprintf("-----> Scaling for %s", name),
+					"proctype: qty",
+					"--------: ---",
+				}
+				for _, procType := range sortedKeys(app.scale) {
+					lines = append(lines, fmt.Sprintf("%s: %d", procType, app.scale[procType]))
+				}
+				return fakeDokkuOk(lines...)
+			}
+
+			if _, skipDeploy := flags["--skip-deploy"]; !skipDeploy {
+				if !app.deployed {
+					return fakeDokkuFail("App %s has not been deployed", name)
+				}
+				if app.locked {
+					return fakeDokkuFail("Deploy lock in place for %s", name)
+				}
+			}
+
+			for _, arg := range args[1:] {
+				procType, count, ok := strings.Cut(arg, "=")
+				qty, err := strconv.Atoi(count)
+				if !ok || err != nil {
+					return fakeDokkuFail("Invalid scale argument: %s", arg)
+				}
+				app.scale[procType] = qty
+			}
+			return fakeDokkuOk(fmt.Sprintf("-----> Scaling %s processes: %s", name, strings.Join(args[1:], " ")))
+		},
+
+		"docker-options:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s docker options information", name),
+				[]string{"Docker options build", "Docker options deploy", "Docker options run"},
+				map[string]string{
+					"Docker options build":  strings.Join(app.dockerOptions["build"], " "),
+					"Docker options deploy": strings.Join(app.dockerOptions["deploy"], " "),
+					"Docker options run":    strings.Join(app.dockerOptions["run"], " "),
+				})
+		},
+
+		"docker-options:add": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 3 {
+				return fakeDokkuFail("Please specify a phase and option")
+			}
+			for _, phase := range strings.Split(args[1], ",") {
+				option := strings.Join(args[2:], " ")
+				if _, ok := sliceToLookupMap(app.dockerOptions[phase])[option]; !ok {
+					app.dockerOptions[phase] = append(app.dockerOptions[phase], option)
+				}
+			}
+			return fakeDokkuOk()
+		},
+
+		"docker-options:remove": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 3 {
+				return fakeDokkuFail("Please specify a phase and option")
+			}
+			for _, phase := range strings.Split(args[1], ",") {
+				app.dockerOptions[phase] = fakeDokkuRemove(app.dockerOptions[phase], strings.Join(args[2:], " "))
+			}
+			return fakeDokkuOk()
+		},
+
+		"storage:ensure-directory": func(f *fakeDokku, args []string) fakeDokkuResult {
+			positional, flags := fakeDokkuFlags(args)
+			if len(positional) == 0 {
+				return fakeDokkuFail("Please specify a name for the storage directory")
+			}
+			chown, ok := flags["--chown"]
+			if !ok {
+				chown = "herokuish"
+			}
+			if _, ok := f.storage[positional[0]]; !ok {
+				f.storage[positional[0]] = chown
+			}
+			return fakeDokkuOk(fmt.Sprintf("-----> Ensuring %s/%s exists", dokkuStorageRoot, positional[0]))
+		},
+
+		// Like dokku, mounts are stored as deploy & run docker options
+		"storage:mount": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 2 || !strings.Contains(args[1], ":") {
+				return fakeDokkuFail("Please specify a mount path")
+			}
+			option := "-v " + args[1]
+			if _, ok := sliceToLookupMap(app.dockerOptions["deploy"])[option]; ok {
+				return fakeDokkuFail("Mount path already exists.")
+			}
+			app.dockerOptions["deploy"] = append(app.dockerOptions["deploy"], option)
+			app.dockerOptions["run"] = append(app.dockerOptions["run"], option)
+			return fakeDokkuOk()
+		},
+
+		"storage:unmount": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 2 {
+				return fakeDokkuFail("Please specify a mount path")
+			}
+			option := "-v " + args[1]
+			if _, ok := sliceToLookupMap(app.dockerOptions["deploy"])[option]; !ok {
+				return fakeDokkuFail("Mount path does not exist.")
+			}
+			app.dockerOptions["deploy"] = fakeDokkuRemove(app.dockerOptions["deploy"], option)
+			app.dockerOptions["run"] = fakeDokkuRemove(app.dockerOptions["run"], option)
+			return fakeDokkuOk()
+		},
+
+		"storage:list": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			lines := []string{fmt.Sprintf("=====> %s volume bind-mounts:", name)}
+			for _, option := range app.dockerOptions["deploy"] {
+				if strings.HasPrefix(option, "-v ") {
+					lines = append(lines, "     "+strings.TrimPrefix(option, "-v "))
+				}
+			}
+			return fakeDokkuOk(lines...)
+		},
+
+		"letsencrypt:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s letsencrypt information", name),
+				[]string{"Letsencrypt active", "Letsencrypt autorenew", "Letsencrypt dns provider", "Letsencrypt email", "Letsencrypt expiration", "Letsencrypt server"},
+				map[string]string{
+					"Letsencrypt active":       strconv.FormatBool(app.letsencryptExpiry != ""),
+					"Letsencrypt autorenew":    strconv.FormatBool(f.letsencryptCron),
+					"Letsencrypt dns provider": app.letsencrypt["dns-provider"],
+					"Letsencrypt email":        app.letsencrypt["email"],
+					"Letsencrypt expiration":   app.letsencryptExpiry,
+					"Letsencrypt server":       app.letsencrypt["server"],
+				})
+		},
+
+		"letsencrypt:set": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 2 {
+				return fakeDokkuFail("No property specified")
+			}
+			if len(args) == 2 {
+				delete(app.letsencrypt, args[1])
+				return fakeDokkuOk(fmt.Sprintf("-----> Unsetting %s", args[1]))
+			}
+			app.letsencrypt[args[1]] = strings.Join(args[2:], " ")
+			return fakeDokkuOk(fmt.Sprintf("-----> Setting %s", args[1]))
+		},
+
+		// Stands in for the ACME server, issuing a certificate straight away
+		"letsencrypt:enable": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if app.letsencrypt["email"] == "" {
+				return fakeDokkuFail("DOKKU_LETSENCRYPT_EMAIL not set")
+			}
+			app.letsencryptExpiry = time.Now().UTC().Add(90 * 24 * time.Hour).Format("2006-01-02 15:04:05")
+			return fakeDokkuOk(fmt.Sprintf("=====> Let's Encrypt %s", name), "-----> Certificate retrieved successfully.")
+		},
+
+		"letsencrypt:disable": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			app.letsencryptExpiry = ""
+			return fakeDokkuOk(fmt.Sprintf("-----> Disabling letsencrypt for %s", name))
+		},
+
+		"letsencrypt:list": func(f *fakeDokku, args []string) fakeDokkuResult {
+			lines := []string{"-----> App name           Certificate Expiry        Time before expiry        Time before renewal"}
+			for _, name := range sortedKeys(f.apps) {
+				if expiry := f.apps[name].letsencryptExpiry; expiry != "" {
+					lines = append(lines, fmt.Sprintf("%-18s %-25s %-25s %-25s", name, expiry, "89d, 23h, 59m, 59s", "59d, 23h, 59m, 59s"))
+				}
+			}
+			return fakeDokkuOk(lines...)
+		},
+
+		"letsencrypt:cron-job": func(f *fakeDokku, args []string) fakeDokkuResult {
+			_, flags := fakeDokkuFlags(args, "--add", "--remove")
+			if _, ok := flags["--add"]; ok {
+				f.letsencryptCron = true
+			} else if _, ok := flags["--remove"]; ok {
+				f.letsencryptCron = false
+			}
+			return fakeDokkuOk()
+		},
+
+		"certs:add":    fakeDokkuCertsAdd,
+		"certs:update": fakeDokkuCertsAdd,
+
+		"certs:remove": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if app.cert == nil {
+				return fakeDokkuFail("%s does not have an ssl endpoint", name)
+			}
+			app.cert = nil
+			return fakeDokkuOk("-----> Removing SSL endpoint from " + name)
+		},
+
+		"certs:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			values := map[string]string{
+				"Ssl dir":     fmt.Sprintf("/home/dokku/%s/tls", name),
+				"Ssl enabled": strconv.FormatBool(app.cert != nil),
+			}
+			if app.cert != nil {
+				values["Ssl expires at"] = app.cert.NotAfter.UTC().Format("Jan _2 15:04:05 2006 GMT")
+				values["Ssl hostnames"] = strings.Join(app.cert.DNSNames, " ")
+				values["Ssl issuer"] = app.cert.Issuer.String()
+				values["Ssl starts at"] = app.cert.NotBefore.UTC().Format("Jan _2 15:04:05 2006 GMT")
+				values["Ssl subject"] = app.cert.Subject.String()
+				values["Ssl verified"] = "self signed"
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s ssl information", name),
+				[]string{"Ssl dir", "Ssl enabled", "Ssl hostnames", "Ssl expires at", "Ssl issuer", "Ssl starts at", "Ssl subject", "Ssl verified"},
+				values)
+		},
+
+		"git:from-image": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			positional, _ := fakeDokkuFlags(args[1:])
+			if len(positional) == 0 {
+				return fakeDokkuFail("Please specify a docker image")
+			}
+			if positional[0] == app.sourceImage {
+				return fakeDokkuFail("No changes detected, skipping git commit")
+			}
+			app.sourceImage = positional[0]
+			f.commit(app, name)
+			f.deploy(app)
+			return fakeDokkuOk(fmt.Sprintf("-----> Deploying %s via the docker image %s", name, positional[0]))
+		},
+
+		// Reads a tarball of the app's source from stdin
+		"tar:in": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			source := make(map[string][]byte)
+			tr := tar.NewReader(bytes.NewReader(f.stdin))
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return fakeDokkuFail("Tar archive is invalid: %v", err)
+				}
+				if header.Typeflag != tar.TypeReg {
+					continue
+				}
+				content, err := io.ReadAll(tr)
+				if err != nil {
+					return fakeDokkuFail("Tar archive is invalid: %v", err)
+				}
+				source[header.Name] = content
+			}
+			if len(source) == 0 {
+				return fakeDokkuFail("No files in tarball")
+			}
+			app.source = source
+			f.deploy(app)
+			return fakeDokkuOk(fmt.Sprintf("-----> Deploying %s from a tarball", name))
+		},
+
+		"git:sync": func(f *fakeDokku, args []string) fakeDokkuResult {
+			positional, flags := fakeDokkuFlags(args, "--build", "--build-if-changes")
+			app, name, fail := f.app(positional)
+			if fail != nil {
+				return *fail
+			}
+			if len(positional) < 2 {
+				return fakeDokkuFail("Please specify a remote git repository")
+			}
+			app.sourceImage = ""
+			f.commit(app, name)
+			if len(positional) > 2 && regexp.MustCompile(`^[0-9a-f]{40}$`).MatchString(positional[2]) {
+				app.gitSha = positional[2]
+			}
+			if _, ok := flags["--build"]; ok {
+				f.deploy(app)
+			}
+			return fakeDokkuOk(fmt.Sprintf("-----> Syncing %s from %s", name, positional[1]))
+		},
+
+		"git:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s git information", name),
+				[]string{"Git deploy branch", "Git global deploy branch", "Git keep git dir", "Git rev env var", "Git sha", "Git source image", "Git last updated at"},
+				map[string]string{
+					"Git deploy branch":        "master",
+					"Git global deploy branch": "master",
+					"Git keep git dir":         "false",
+					"Git rev env var":          "GIT_REV",
+					"Git sha":                  app.gitSha,
+					"Git source image":         app.sourceImage,
+				})
+		},
+
+		"resource:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			procTypes := []string{"_default_"}
+			for _, procType := range sortedKeys(app.resources) {
+				if procType != "_default_" {
+					procTypes = append(procTypes, procType)
+				}
+			}
+			keys := []string{}
+			values := make(map[string]string)
+			for _, procType := range procTypes {
+				label := procType
+				if procType == "_default_" {
+					label = "default"
+				}
+				for _, kind := range []string{"limit", "reserve"} {
+					for _, resourceType := range fakeDokkuResourceTypes {
+						key := fmt.Sprintf("Resource %s %s %s", label, kind, strings.ReplaceAll(resourceType, "-", " "))
+						keys = append(keys, key)
+						values[key] = app.resources[procType][kind][resourceType]
+					}
+				}
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s resource information", name), keys, values)
+		},
+
+		"proxy:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s proxy information", name),
+				[]string{"Proxy enabled", "Proxy computed type", "Proxy global type", "Proxy type"},
+				map[string]string{
+					"Proxy enabled":       strconv.FormatBool(!app.proxyDisabled),
+					"Proxy computed type": app.computedProxyType(),
+					"Proxy global type":   "nginx",
+					"Proxy type":          app.proxyType,
+				})
+		},
+
+		"proxy:set": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 2 {
+				app.proxyType = ""
+				return fakeDokkuOk("-----> Unsetting proxy type")
+			}
+			app.proxyType = args[1]
+			return fakeDokkuOk(fmt.Sprintf("-----> Setting proxy type to %s", args[1]))
+		},
+
+		"proxy:enable": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			app.proxyDisabled = false
+			return fakeDokkuOk(fmt.Sprintf("-----> Enabling proxy for app (%s)", name))
+		},
+
+		"proxy:disable": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			app.proxyDisabled = true
+			return fakeDokkuOk(fmt.Sprintf("-----> Disabling proxy for app (%s)", name))
+		},
+
+		"proxy:build-config": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if !app.deployed {
+				return fakeDokkuOk()
+			}
+			app.proxyBuilds++
+			return fakeDokkuOk(fmt.Sprintf("-----> Configuring %s...(using built-in template)", name))
+		},
+
+		"checks:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			list := func(processTypes []string) string {
+				if len(processTypes) == 0 {
+					return "none"
+				}
+				return strings.Join(processTypes, ",")
+			}
+			waitToRetire := app.checks["wait-to-retire"]
+			if waitToRetire == "" {
+				waitToRetire = "60"
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s checks information", name),
+				[]string{"Checks disabled list", "Checks skipped list", "Checks computed wait to retire", "Checks global wait to retire", "Checks wait to retire"},
+				map[string]string{
+					"Checks disabled list":           list(app.checksDisabled),
+					"Checks skipped list":            list(app.checksSkipped),
+					"Checks computed wait to retire": waitToRetire,
+					"Checks global wait to retire":   "60",
+					"Checks wait to retire":          app.checks["wait-to-retire"],
+				})
+		},
+
+		"checks:enable":  fakeDokkuChecksToggle,
+		"checks:disable": fakeDokkuChecksToggle,
+		"checks:skip":    fakeDokkuChecksToggle,
+
+		"checks:set": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 2 {
+				return fakeDokkuFail("No property specified")
+			}
+			if args[1] != "wait-to-retire" {
+				return fakeDokkuFail("Invalid property specified, valid properties include: wait-to-retire")
+			}
+			if len(args) < 3 {
+				delete(app.checks, args[1])
+				return fakeDokkuOk(fmt.Sprintf("-----> Unsetting %s", args[1]))
+			}
+			app.checks[args[1]] = args[2]
+			return fakeDokkuOk(fmt.Sprintf("-----> Setting %s to %s", args[1], args[2]))
+		},
+
+		"nginx:report": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			// Stands in for hosts running another proxy, where the nginx
+			// commands can't be relied on
+			if app.computedProxyType() != "nginx" {
+				return fakeDokkuFail("%s doesn't use the nginx proxy", name)
+			}
+			keys := []string{}
+			values := make(map[string]string)
+			for _, prop := range fakeDokkuNginxProperties {
+				key := "Nginx " + strings.ReplaceAll(prop, "-", " ")
+				keys = append(keys, key)
+				values[key] = app.nginx[prop]
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s nginx information", name), keys, values)
+		},
+
+		"nginx:show-config": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if !app.deployed {
+				return fakeDokkuFail("No nginx.conf exists for %s", name)
+			}
+			return fakeDokkuOk(fmt.Sprintf("server {\n  listen 80;\n  server_name %s;\n}", name))
+		},
+
+		"nginx:set": func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if app.computedProxyType() != "nginx" {
+				return fakeDokkuFail("%s doesn't use the nginx proxy", name)
+			}
+			if len(args) < 2 {
+				return fakeDokkuFail("No property specified")
+			}
+			if _, ok := sliceToLookupMap(fakeDokkuNginxProperties)[args[1]]; !ok {
+				return fakeDokkuFail("Invalid property specified, valid properties include: %s", strings.Join(fakeDokkuNginxProperties, ", "))
+			}
+			if len(args) < 3 || args[2] == "" {
+				delete(app.nginx, args[1])
+				return fakeDokkuOk(fmt.Sprintf("-----> Unsetting %s", args[1]))
+			}
+			// dokku reads the template from the app's repository, and never
+			// treats the path as absolute
+			if args[1] == "nginx-conf-sigil-path" && strings.HasPrefix(args[2], "/") {
+				return fakeDokkuFail("nginx-conf-sigil-path must be relative to the root of the repository")
+			}
+			app.nginx[args[1]] = strings.Join(args[2:], " ")
+			return fakeDokkuOk(fmt.Sprintf("-----> Setting %s to %s", args[1], app.nginx[args[1]]))
+		},
+	}
+
+	for plugin, properties := range fakeDokkuBuilderProperties {
+		plugin, properties := plugin, properties
+		title := strings.ReplaceAll(plugin, "-", " ")
+		title = strings.ToUpper(title[:1]) + title[1:]
+
+		// Shows the app's value of each property, the global value (which
+		// is never set in the fake) and the computed value of the two
+		fakeDokkuCommands[plugin+":report"] = func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, name, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			keys := []string{}
+			values := make(map[string]string)
+			for _, property := range properties {
+				words := strings.ReplaceAll(property, "-", " ")
+				for _, scope := range []string{"computed ", "global ", ""} {
+					key := fmt.Sprintf("%s %s%s", title, scope, words)
+					keys = append(keys, key)
+					if scope != "global " {
+						values[key] = app.builder[plugin+" "+property]
+					}
+				}
+			}
+			return fakeDokkuReport(fmt.Sprintf("%s %s information", name, plugin), keys, values)
+		}
+
+		fakeDokkuCommands[plugin+":set"] = func(f *fakeDokku, args []string) fakeDokkuResult {
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			if len(args) < 2 {
+				return fakeDokkuFail("No property specified")
+			}
+			if _, ok := sliceToLookupMap(properties)[args[1]]; !ok {
+				return fakeDokkuFail("Invalid property specified, valid properties include: %s", strings.Join(properties, ", "))
+			}
+			key := plugin + " " + args[1]
+			if len(args) < 3 || args[2] == "" {
+				delete(app.builder, key)
+				return fakeDokkuOk(fmt.Sprintf("-----> Unsetting %s", args[1]))
+			}
+			app.builder[key] = args[2]
+			return fakeDokkuOk(fmt.Sprintf("-----> Setting %s to %s", args[1], args[2]))
+		}
+	}
+
+	for _, kind := range []string{"limit", "reserve"} {
+		kind := kind
+
+		fakeDokkuCommands["resource:"+kind] = func(f *fakeDokku, args []string) fakeDokkuResult {
+			args, flags := fakeDokkuFlags(args)
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			procType := "_default_"
+			if p, ok := flags["--process-type"]; ok {
+				procType = p
+				delete(flags, "--process-type")
+			}
+			if app.resources[procType] == nil {
+				app.resources[procType] = make(map[string]map[string]string)
+			}
+			if app.resources[procType][kind] == nil {
+				app.resources[procType][kind] = make(map[string]string)
+			}
+			for flag, value := range flags {
+				resourceType := strings.TrimPrefix(flag, "--")
+				if _, ok := sliceToLookupMap(fakeDokkuResourceTypes)[resourceType]; !ok {
+					return fakeDokkuFail("Invalid flag: %s", flag)
+				}
+				app.resources[procType][kind][resourceType] = value
+			}
+			return fakeDokkuOk(fmt.Sprintf("=====> Setting resource %ss for %s", kind, procType))
+		}
+
+		fakeDokkuCommands["resource:"+kind+"-clear"] = func(f *fakeDokku, args []string) fakeDokkuResult {
+			args, flags := fakeDokkuFlags(args)
+			app, _, fail := f.app(args)
+			if fail != nil {
+				return *fail
+			}
+			procType := "_default_"
+			if p, ok := flags["--process-type"]; ok {
+				procType = p
+			}
+			if app.resources[procType] != nil {
+				delete(app.resources[procType], kind)
+			}
+			return fakeDokkuOk(fmt.Sprintf("-----> Clearing %s %s", kind, procType))
+		}
+	}
+
+	// Older versions of dokku managed ports through the proxy plugin
+	fakeDokkuCommands["proxy:ports"] = fakeDokkuCommands["ports:list"]
+	fakeDokkuCommands["proxy:ports-add"] = fakeDokkuCommands["ports:add"]
+	fakeDokkuCommands["proxy:ports-remove"] = fakeDokkuCommands["ports:remove"]
+}
+
+type fakeDokkuServiceCommand func(f *fakeDokku, plugin string, args []string) fakeDokkuResult
+
+func (f *fakeDokku) service(plugin string, args []string) (*fakeDokkuService, string, *fakeDokkuResult) {
+	if len(args) == 0 {
+		res := fakeDokkuFail("Please specify a valid name for the service")
+		return nil, "", &res
+	}
+
+	s, ok := f.services[plugin][args[0]]
+	if !ok {
+		res := fakeDokkuFail("%s service %s does not exist", fakeDokkuPlugins[plugin].title, args[0])
+		return nil, args[0], &res
+	}
+
+	return s, args[0], nil
+}
+
+func (f *fakeDokku) createService(plugin string, name string, flags map[string]string) fakeDokkuResult {
+	if _, ok := f.services[plugin][name]; ok {
+		return fakeDokkuFail("%s service %s already exists", fakeDokkuPlugins[plugin].title, name)
+	}
+
+	defaults := fakeDokkuPlugins[plugin]
+	s := &fakeDokkuService{
+		image:        defaults.image,
+		imageVersion: defaults.imageVersion,
+		links:        make(map[string]string),
+	}
+	if image, ok := flags["--image"]; ok {
+		s.image = image
+	}
+	if version, ok := flags["--image-version"]; ok {
+		s.imageVersion = version
+	}
+
+	if f.services[plugin] == nil {
+		f.services[plugin] = make(map[string]*fakeDokkuService)
+	}
+	f.services[plugin][name] = s
+
+	return fakeDokkuOk(fmt.Sprintf("=====> %s container created: %s", fakeDokkuPlugins[plugin].title, name))
+}
+
+func (s *fakeDokkuService) dsn(plugin string, name string) string {
+	defaults := fakeDokkuPlugins[plugin]
+	return fmt.Sprintf("%s://%s:password@dokku-%s-%s:%d/%s", defaults.scheme, plugin, plugin, name, defaults.port, name)
+}
+
+var fakeDokkuServiceCommands = map[string]fakeDokkuServiceCommand{
+	"create": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		args, flags := fakeDokkuFlags(args)
+		if len(args) == 0 {
+			return fakeDokkuFail("Please specify a valid name for the service")
+		}
+		return f.createService(plugin, args[0], flags)
+	},
+
+	"clone": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		args, flags := fakeDokkuFlags(args)
+		s, _, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		if len(args) < 2 {
+			return fakeDokkuFail("Please specify a name for the new service")
+		}
+		if _, ok := flags["--image"]; !ok {
+			flags["--image"] = s.image
+		}
+		if _, ok := flags["--image-version"]; !ok {
+			flags["--image-version"] = s.imageVersion
+		}
+		return f.createService(plugin, args[1], flags)
+	},
+
+	"info": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		s, name, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		port := fakeDokkuPlugins[plugin].port
+
+		exposed := "-"
+		if len(s.exposed) > 0 {
+			mappings := []string{}
+			for _, e := range s.exposed {
+				mappings = append(mappings, fmt.Sprintf("%d->%s", port, e))
+			}
+			exposed = strings.Join(mappings, " ")
+		}
+
+		links := "-"
+		if len(s.links) > 0 {
+			links = strings.Join(sortedKeys(s.links), " ")
+		}
+
+		status := "running"
+		if s.stopped {
+			status = "exited"
+		}
+
+		return fakeDokkuReport(fmt.Sprintf("%s %s service information", name, plugin),
+			[]string{"Config dir", "Data dir", "Dsn", "Exposed ports", "Links", "Status", "Version"},
+			map[string]string{
+				"Config dir":    fmt.Sprintf("/var/lib/dokku/services/%s/%s/config", plugin, name),
+				"Data dir":      fmt.Sprintf("/var/lib/dokku/services/%s/%s/data", plugin, name),
+				"Dsn":           s.dsn(plugin, name),
+				"Exposed ports": exposed,
+				"Links":         links,
+				"Status":        status,
+				"Version":       fmt.Sprintf("%s:%s", s.image, s.imageVersion),
+			})
+	},
+
+	"destroy": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		args, _ = fakeDokkuFlags(args, "-f", "--force")
+		s, name, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		if len(s.links) > 0 {
+			return fakeDokkuFail("Cannot delete linked service")
+		}
+		delete(f.services[plugin], name)
+		return fakeDokkuOk(fmt.Sprintf("=====> %s container deleted: %s", fakeDokkuPlugins[plugin].title, name))
+	},
+
+	"stop": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		s, _, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		s.stopped = true
+		return fakeDokkuOk("-----> Stopping container")
+	},
+
+	"start": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		s, _, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		s.stopped = false
+		return fakeDokkuOk("-----> Starting container")
+	},
+
+	"expose": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		s, _, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		if len(s.exposed) > 0 {
+			return fakeDokkuFail("Service %s already exposed on port(s) %s", args[0], strings.Join(s.exposed, " "))
+		}
+		s.exposed = append([]string{}, args[1:]...)
+		return fakeDokkuOk(fmt.Sprintf("-----> Service %s exposed on port(s) %s", args[0], strings.Join(s.exposed, " ")))
+	},
+
+	"unexpose": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		s, _, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		s.exposed = nil
+		return fakeDokkuOk("-----> Service unexposed")
+	},
+
+	"upgrade": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		args, flags := fakeDokkuFlags(args)
+		s, _, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		if image, ok := flags["--image"]; ok {
+			s.image = image
+		}
+		if version, ok := flags["--image-version"]; ok {
+			s.imageVersion = version
+		}
+		s.stopped = false
+		return fakeDokkuOk("-----> Upgrading container")
+	},
+
+	"link": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		args, flags := fakeDokkuFlags(args)
+		s, name, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		app, appName, fail := f.app(args[1:])
+		if fail != nil {
+			return *fail
+		}
+
+		alias := fakeDokkuPlugins[plugin].alias
+		if a, ok := flags["--alias"]; ok {
+			alias = strings.TrimSuffix(strings.ToUpper(a), "_URL")
+		}
+
+		if existing, ok := s.links[appName]; ok {
+			return fakeDokkuFail("Already linked as %s_URL", existing)
+		}
+
+		dsn := s.dsn(plugin, name)
+		if qs, ok := flags["--querystring"]; ok {
+			dsn = dsn + "?" + qs
+		}
+
+		s.links[appName] = alias
+		app.config[alias+"_URL"] = dsn
+		return fakeDokkuOk(fmt.Sprintf("-----> Setting config vars\n       %s_URL:  %s", alias, dsn))
+	},
+
+	"unlink": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		s, _, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		app, appName, fail := f.app(args[1:])
+		if fail != nil {
+			return *fail
+		}
+		alias, ok := s.links[appName]
+		if !ok {
+			return fakeDokkuFail("Not linked to app %s", appName)
+		}
+		delete(s.links, appName)
+		delete(app.config, alias+"_URL")
+		return fakeDokkuOk("-----> Unsetting config vars")
+	},
+
+	"linked": func(f *fakeDokku, plugin string, args []string) fakeDokkuResult {
+		s, _, fail := f.service(plugin, args)
+		if fail != nil {
+			return *fail
+		}
+		_, appName, fail := f.app(args[1:])
+		if fail != nil {
+			return *fail
+		}
+		if _, ok := s.links[appName]; !ok {
+			return fakeDokkuResult{status: 1}
+		}
+		return fakeDokkuOk()
+	},
+}
+
+func fakeDokkuRemove(slice []string, toRemove ...string) []string {
+	remove := sliceToLookupMap(toRemove)
+	kept := []string{}
+	for _, s := range slice {
+		if _, ok := remove[s]; !ok {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// Split a command line into words as sh would, for the quoting the provider
+// uses (single quotes from shellescape, double quotes and backslashes).
+func splitShellWords(line string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("$`\"\\\n", line[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		case c == '\\' && i+1 < len(line):
+			i++
+			word.WriteByte(line[i])
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// fakeDokkuServer serves a fakeDokku over SSH, as dokku's SSH forced command
+// would. Any client key is accepted.
+type fakeDokkuServer struct {
+	*fakeDokku
+
+	listener net.Listener
+	Host     string
+	Port     int
+	HostKey  ssh.PublicKey
+
+	mu    sync.Mutex
+	conns []net.Conn
+	// how many connections have been forwarded through the server, when it's
+	// used as a bastion
+	forwards int
+	// how many commands the client closed the session on before they finished
+	abandoned int
+}
+
+func startFakeDokkuServer(dokku *fakeDokku) (*fakeDokkuServer, error) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &fakeDokkuServer{
+		fakeDokku: dokku,
+		listener:  listener,
+		Host:      "127.0.0.1",
+		Port:      listener.Addr().(*net.TCPAddr).Port,
+		HostKey:   hostSigner.PublicKey(),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handleConn(conn, config)
+		}
+	}()
+
+	return server, nil
+}
+
+func (s *fakeDokkuServer) Close() error {
+	return s.listener.Close()
+}
+
+// DropConnections closes every connection accepted so far, as if the host had
+// gone away, while still accepting new ones
+func (s *fakeDokkuServer) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeDokkuServer) handleConn(conn net.Conn, config *ssh.ServerConfig) {
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		log.Printf("[DEBUG] fake dokku: handshake failed: %v", err)
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go s.forward(newChannel)
+			continue
+		}
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(channel, requests)
+	}
+}
+
+// How many connections have been forwarded through the server
+func (s *fakeDokkuServer) Forwards() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.forwards
+}
+
+// How many commands have been abandoned by the client part way through
+func (s *fakeDokkuServer) Abandoned() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.abandoned
+}
+
+// Forward a connection on to the address it asks for, as sshd does for a jump
+// host
+func (s *fakeDokkuServer) forward(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid forward request")
+		return
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	s.mu.Lock()
+	s.forwards++
+	s.mu.Unlock()
+
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+	channel.Close()
+}
+
+func (s *fakeDokkuServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for req := range requests {
+		// Like the dokku user's forced command, only commands can be run, so
+		// subsystems such as SFTP are refused
+		if req.Type != "exec" {
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+			continue
+		}
+
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		// The client closes stdin once it's been sent, even when empty
+		stdin, err := io.ReadAll(channel)
+		if err != nil {
+			return
+		}
+
+		// The client closes the session to abandon the command, e.g. when
+		// terraform is interrupted
+		closed := make(chan struct{})
+		go func() {
+			for req := range requests {
+				if req.WantReply {
+					req.Reply(false, nil)
+				}
+			}
+			close(closed)
+		}()
+
+		done := make(chan fakeDokkuResult, 1)
+		go func() {
+			done <- s.ExecWithStdin(payload.Command, stdin)
+		}()
+
+		select {
+		case res := <-done:
+			io.WriteString(channel, res.stdout)
+			io.WriteString(channel.Stderr(), res.stderr)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(res.status)}))
+		case <-closed:
+			s.mu.Lock()
+			s.abandoned++
+			s.mu.Unlock()
+		}
+		return
+	}
+}
+
+func (app *fakeDokkuApp) computedProxyType() string {
+	if app.proxyType == "" {
+		return "nginx"
+	}
+	return app.proxyType
+}
+
+// Point the provider's environment at the fake server, with keys to
+// authenticate with (written to dir) as the acceptance tests expect.
+func (s *fakeDokkuServer) setEnv(dir string) error {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	keyPem, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return err
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(keyPem), 0600); err != nil {
+		return err
+	}
+
+	encryptedPem, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte("foobar"))
+	if err != nil {
+		return err
+	}
+	encryptedPath := filepath.Join(dir, "id_ed25519_passphrase")
+	if err := os.WriteFile(encryptedPath, pem.EncodeToMemory(encryptedPem), 0600); err != nil {
+		return err
+	}
+
+	env := map[string]string{
+		"DOKKU_SSH_HOST":                 s.Host,
+		"DOKKU_SSH_PORT":                 strconv.Itoa(s.Port),
+		"DOKKU_SSH_CERT":                 keyPath,
+		"DOKKU_SSH_CERT_WITH_PASSPHRASE": encryptedPath,
+		"DOKKU_HOST_KEY":                 string(ssh.MarshalAuthorizedKey(s.HostKey)),
+	}
+	for k, v := range env {
+		if err := os.Setenv(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The version of dokku the fake reports
+const fakeDokkuVersion = "0.35.12"
+
+// Start a fake dokku server for a single test, returning it along with a
+// client connected to it. Each server has its own state.
+func newFakeDokkuClient(t *testing.T) (*fakeDokku, *DokkuClient) {
+	t.Helper()
+
+	dokku := newFakeDokku(fakeDokkuVersion)
+	server, err := startFakeDokkuServer(dokku)
+	if err != nil {
+		t.Fatalf("could not start fake dokku server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	conn := NewSshConnection(fakeDokkuDial(t, server), SshConnectionOpts{MaxSessions: 5, ReconnectAttempts: 1})
+	t.Cleanup(func() { conn.Close() })
+
+	return dokku, NewDokkuClient(conn, semver.MustParse(fakeDokkuVersion))
+}
+
+// fakeDokkuDial returns a dial function that connects to the server with a
+// freshly generated key
+func fakeDokkuDial(t *testing.T, server *fakeDokkuServer) func(ctx context.Context) (*goph.Client, error) {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return func(ctx context.Context) (*goph.Client, error) {
+		return sshDial(ctx, (&net.Dialer{}).DialContext, &goph.Config{
+			User:     "dokku",
+			Addr:     server.Host,
+			Port:     uint(server.Port),
+			Auth:     goph.Auth{ssh.PublicKeys(signer)},
+			Callback: ssh.FixedHostKey(server.HostKey),
+			Timeout:  goph.DefaultTimeout,
+		})
+	}
+}
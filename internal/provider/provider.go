@@ -2,29 +2,52 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/melbahja/goph"
-	"golang.org/x/crypto/ssh"
 )
 
-var DOKKU_VERSION semver.Version
-
 // Provider -
 func Provider() *schema.Provider {
 	return &schema.Provider{
 		Schema: map[string]*schema.Schema{
+			"transport": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("DOKKU_TRANSPORT", "ssh"),
+				ValidateFunc: validation.StringInSlice([]string{"ssh", "local"}, false),
+				Description:  "How to run dokku commands. Either 'ssh' to connect to your Dokku server over SSH, or 'local' to run the dokku binary directly when terraform runs on the Dokku server itself. The ssh_* options are ignored for 'local'. Defaults to 'ssh'. Can be set via DOKKU_TRANSPORT environment variable.",
+			},
+			"use_sudo": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("DOKKU_USE_SUDO", false),
+				ConflictsWith: []string{"command_prefix"},
+				Description:   "Whether to run commands as `sudo -n dokku <command>`, for connecting as a user other than dokku that has passwordless sudo access to dokku. Defaults to false. Can be set via DOKKU_USE_SUDO environment variable.",
+			},
+			"command_prefix": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("DOKKU_COMMAND_PREFIX", nil),
+				ConflictsWith: []string{"use_sudo"},
+				Description:   "A prefix for every command run, e.g '/usr/bin/dokku' or 'sudo -n -u dokku dokku', for when the dokku binary isn't run for you (i.e the SSH user isn't the dokku user). Can be set via DOKKU_COMMAND_PREFIX environment variable.",
+			},
 			"ssh_host": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("DOKKU_SSH_HOST", nil),
-				Description: "The hostname of your Dokku server. Can be set via DOKKU_SSH_HOST environment variable.",
+				Description: "The hostname of your Dokku server. Required for the 'ssh' transport. Can be set via DOKKU_SSH_HOST environment variable.",
 			},
 			"ssh_user": {
 				Type:        schema.TypeString,
@@ -40,9 +63,9 @@ func Provider() *schema.Provider {
 			},
 			"ssh_cert": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("DOKKU_SSH_CERT", nil),
-				Description: "Either a path to the SSH private key for connecting to your Dokku server OR the source for an SSH key directly. Can be set via DOKKU_SSH_CERT environment variable.",
+				Description: "Either a path to the SSH private key for connecting to your Dokku server OR the source for an SSH key directly. Required unless ssh_agent is set. Can be set via DOKKU_SSH_CERT environment variable.",
 			},
 			"ssh_passphrase": {
 				Type:        schema.TypeString,
@@ -50,6 +73,18 @@ func Provider() *schema.Provider {
 				DefaultFunc: schema.EnvDefaultFunc("DOKKU_SSH_PASSPHRASE", nil),
 				Description: "An optional passphrase to be used in conjunction with the provided SSH key.",
 			},
+			"ssh_agent": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DOKKU_SSH_AGENT", false),
+				Description: "Whether to authenticate using the keys held by the running ssh-agent (via SSH_AUTH_SOCK), in addition to ssh_cert. Defaults to false. Can be set via DOKKU_SSH_AGENT environment variable.",
+			},
+			"ssh_user_certificate": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DOKKU_SSH_USER_CERTIFICATE", nil),
+				Description: "Either a path to an OpenSSH user certificate OR the certificate directly, signed for the key in ssh_cert or a key held by the ssh-agent. Can be set via DOKKU_SSH_USER_CERTIFICATE environment variable.",
+			},
 			"fail_on_untested_version": {
 				Type:        schema.TypeBool,
 				Optional:    true,
@@ -62,9 +97,111 @@ func Provider() *schema.Provider {
 				DefaultFunc: schema.EnvDefaultFunc("DOKKU_SKIP_KNOWN_HOSTS_CHECK", false),
 				Description: "Whether to skip SSH known hosts verification. Defaults to false. Can be set via DOKKU_SKIP_KNOWN_HOSTS_CHECK environment variable.",
 			},
+			"host_key": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("DOKKU_HOST_KEY", nil),
+				ConflictsWith: []string{"host_key_fingerprint", "known_hosts"},
+				Description:   "The public host key of your Dokku server, in authorized_keys format (e.g. 'ssh-ed25519 AAAA...'). When set the host key is checked strictly against it and ~/.ssh/known_hosts is neither read nor written. Can be set via DOKKU_HOST_KEY environment variable.",
+			},
+			"host_key_fingerprint": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("DOKKU_HOST_KEY_FINGERPRINT", nil),
+				ConflictsWith: []string{"host_key", "known_hosts"},
+				Description:   "The fingerprint of your Dokku server's host key, e.g 'SHA256:...' as output by `ssh-keygen -lf`. When set the host key is checked strictly against it and ~/.ssh/known_hosts is neither read nor written. Can be set via DOKKU_HOST_KEY_FINGERPRINT environment variable.",
+			},
+			"known_hosts": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("DOKKU_KNOWN_HOSTS", nil),
+				ConflictsWith: []string{"host_key", "host_key_fingerprint"},
+				Description:   "The contents of a known_hosts file to verify your Dokku server's host key against. Hosts not listed are rejected and ~/.ssh/known_hosts is neither read nor written. Can be set via DOKKU_KNOWN_HOSTS environment variable.",
+			},
+			"bastion": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "An SSH bastion (jump host) to tunnel the connection to your Dokku server through.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"ssh_host": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The hostname of the bastion.",
+						},
+						"ssh_user": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The SSH user to connect to the bastion as.",
+						},
+						"ssh_port": {
+							Type:        schema.TypeInt,
+							Optional:    true,
+							Default:     22,
+							Description: "The SSH port of the bastion. Defaults to 22.",
+						},
+						"ssh_cert": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "Either a path to the SSH private key for connecting to the bastion OR the source for an SSH key directly. Defaults to the key used for the Dokku server. Keys held by the ssh-agent are also offered if ssh_agent is set.",
+						},
+						"ssh_passphrase": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "An optional passphrase to be used in conjunction with the bastion's SSH key.",
+						},
+						"skip_known_hosts_check": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     false,
+							Description: "Whether to skip SSH known hosts verification of the bastion. Defaults to false.",
+						},
+						"host_key": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The public host key of the bastion, in authorized_keys format. When set the host key is checked strictly against it and ~/.ssh/known_hosts is neither read nor written.",
+						},
+						"host_key_fingerprint": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The fingerprint of the bastion's host key, e.g 'SHA256:...'. When set the host key is checked strictly against it and ~/.ssh/known_hosts is neither read nor written.",
+						},
+						"known_hosts": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The contents of a known_hosts file to verify the bastion's host key against. When set ~/.ssh/known_hosts is neither read nor written.",
+						},
+					},
+				},
+			},
+			"ssh_max_sessions": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DOKKU_SSH_MAX_SESSIONS", 5),
+				Description: "The maximum number of SSH sessions to have open on the connection at once. Should be kept below the MaxSessions setting of the host's sshd. Defaults to 5. Can be set via DOKKU_SSH_MAX_SESSIONS environment variable.",
+			},
+			"ssh_reconnect_attempts": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DOKKU_SSH_RECONNECT_ATTEMPTS", 5),
+				Description: "How many times to try (re)establishing the SSH connection, backing off exponentially between attempts. Defaults to 5. Can be set via DOKKU_SSH_RECONNECT_ATTEMPTS environment variable.",
+			},
+			"ssh_keepalive_interval": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DOKKU_SSH_KEEPALIVE_INTERVAL", 30),
+				Description: "Interval in seconds between SSH keepalive requests, set to 0 to disable. Defaults to 30. Can be set via DOKKU_SSH_KEEPALIVE_INTERVAL environment variable.",
+			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"dokku_app":                     resourceApp(),
+			"dokku_app_certificate":         resourceAppCertificate(),
+			"dokku_app_deploy":              resourceAppDeploy(),
+			"dokku_app_storage":             resourceAppStorage(),
+			"dokku_letsencrypt":             resourceLetsencrypt(),
 			"dokku_postgres_service":        resourcePostgresService(),
 			"dokku_postgres_service_link":   resourcePostgresServiceLink(),
 			"dokku_redis_service":           resourceRedisService(),
@@ -79,72 +216,51 @@ func Provider() *schema.Provider {
 	}
 }
 
-func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+// Set up the SSH connection to the dokku host
+func configureSshConnection(ctx context.Context, d *schema.ResourceData) (*SshConnection, diag.Diagnostics) {
+	// Connections to the ssh-agent, which are handed to the SSH connection to
+	// close, or closed here if we don't get that far
+	var agentConns []io.Closer
+	defer func() {
+		for _, conn := range agentConns {
+			conn.Close()
+		}
+	}()
+
 	host := d.Get("ssh_host").(string)
+	if host == "" {
+		return nil, diag.Errorf("ssh_host must be set when using the ssh transport")
+	}
+
 	user := d.Get("ssh_user").(string)
 	port := uint(d.Get("ssh_port").(int))
 	ssh_cert := d.Get("ssh_cert").(string)
 	ssh_passphrase := d.Get("ssh_passphrase").(string)
+	ssh_agent := d.Get("ssh_agent").(bool)
 
-	var auth goph.Auth
-	var err error
-	if ssh_passphrase != "" {
-		_, err = ssh.ParsePrivateKeyWithPassphrase([]byte(ssh_cert), []byte(ssh_passphrase))
-	} else {
-		_, err = ssh.ParsePrivateKey([]byte(ssh_cert))
-	}
-
+	auth, agentConn, err := sshAuth(ssh_cert, ssh_passphrase, d.Get("ssh_user_certificate").(string), ssh_agent)
 	if err != nil {
-		log.Printf("[DEBUG] attempting to load SSH cert from file path %s\n", ssh_cert)
-		log.Printf("[DEBUG] %v\n", err)
-		// could not parse a key directly, try it as a filepath
-		var err error
-		auth, err = goph.Key(ssh_cert, ssh_passphrase)
-		if err != nil {
-			return nil, diag.Errorf("Attempted to load private key from file but failed")
-		}
+		return nil, diag.FromErr(err)
 	}
-
-	if auth == nil {
-		log.Printf("[DEBUG] SSH cert looks like its being provided inline\n")
-		var err error
-		auth, err = goph.RawKey(ssh_cert, ssh_passphrase)
-
-		if err != nil {
-			// could not proceed with inline ssh cert
-			return nil, diag.Errorf("Could not auth with inline SSH key: %v", err)
-		}
+	if agentConn != nil {
+		agentConns = append(agentConns, agentConn)
 	}
 
 	log.Printf("[DEBUG] establishing SSH connection\n")
 	log.Printf("[DEBUG] host %v\n", host)
 	log.Printf("[DEBUG] user %v\n", user)
 	log.Printf("[DEBUG] port %v\n", port)
+	log.Printf("[DEBUG] ssh_agent %v\n", ssh_agent)
 	log.Printf("[DEBUG] skip_known_hosts_check %v\n", d.Get("skip_known_hosts_check").(bool))
 
-	var diags diag.Diagnostics
-
-	// Check known hosts
-	// https://github.com/melbahja/goph/blob/6258fe9f54bb1f738543020ade7ab22c1dd233d7/examples/goph/main.go#L75-L109
-	verifyFn := func(host string, remote net.Addr, key ssh.PublicKey) error {
-		// See https://github.com/aaronstillwell/terraform-provider-dokku/issues/15 - this option
-		// has been implemented to support using the provider on Terraform Cloud
-		if d.Get("skip_known_hosts_check").(bool) == false {
-			hostFound, err := goph.CheckKnownHost(host, remote, key, "")
-
-			// Host in known hosts but key mismatch
-			if hostFound && err != nil {
-				return err
-			}
-
-			// handshake because public key already exists.
-			if hostFound && err == nil {
-				return nil
-			}
-		} else {
-			log.Printf("[WARN]: skip_known_hosts_check is set to true, no key verification will be run against the SSH host")
-		}
-		return goph.AddKnownHost(host, remote, key, "")
+	callback, err := hostKeyCallback(hostKeyOpts{
+		SkipKnownHostsCheck: d.Get("skip_known_hosts_check").(bool),
+		HostKey:             d.Get("host_key").(string),
+		HostKeyFingerprint:  d.Get("host_key_fingerprint").(string),
+		KnownHosts:          d.Get("known_hosts").(string),
+	})
+	if err != nil {
+		return nil, diag.FromErr(err)
 	}
 
 	sshConfig := &goph.Config{
@@ -152,34 +268,121 @@ func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}
 		Addr:     host,
 		Port:     port,
 		User:     user,
-		Callback: verifyFn,
+		Callback: callback,
+		Timeout:  goph.DefaultTimeout,
 	}
 
-	client, err := goph.NewConn(sshConfig)
-	if err != nil {
+	dial := func(ctx context.Context) (*goph.Client, error) {
+		return sshDial(ctx, (&net.Dialer{}).DialContext, sshConfig)
+	}
+
+	if b, ok := d.GetOk("bastion"); ok {
+		bastion := b.([]interface{})[0].(map[string]interface{})
+
+		bastionCert := bastion["ssh_cert"].(string)
+		bastionPassphrase := bastion["ssh_passphrase"].(string)
+		if bastionCert == "" {
+			bastionCert = ssh_cert
+			bastionPassphrase = ssh_passphrase
+		}
+
+		bastionAuth, bastionAgentConn, err := sshAuth(bastionCert, bastionPassphrase, "", ssh_agent)
+		if err != nil {
+			return nil, diag.Errorf("Bastion: %v", err)
+		}
+		if bastionAgentConn != nil {
+			agentConns = append(agentConns, bastionAgentConn)
+		}
+
+		bastionCallback, err := hostKeyCallback(hostKeyOpts{
+			SkipKnownHostsCheck: bastion["skip_known_hosts_check"].(bool),
+			HostKey:             bastion["host_key"].(string),
+			HostKeyFingerprint:  bastion["host_key_fingerprint"].(string),
+			KnownHosts:          bastion["known_hosts"].(string),
+		})
+		if err != nil {
+			return nil, diag.Errorf("Bastion: %v", err)
+		}
+
+		log.Printf("[DEBUG] connecting via bastion %v@%v:%v\n", bastion["ssh_user"], bastion["ssh_host"], bastion["ssh_port"])
+
+		bastionConfig := &goph.Config{
+			Auth:     bastionAuth,
+			Addr:     bastion["ssh_host"].(string),
+			Port:     uint(bastion["ssh_port"].(int)),
+			User:     bastion["ssh_user"].(string),
+			Callback: bastionCallback,
+			Timeout:  goph.DefaultTimeout,
+		}
+
+		dial = func(ctx context.Context) (*goph.Client, error) {
+			return dialViaBastion(ctx, bastionConfig, sshConfig)
+		}
+	}
+
+	client := NewSshConnection(dial, SshConnectionOpts{
+		MaxSessions:       d.Get("ssh_max_sessions").(int),
+		ReconnectAttempts: d.Get("ssh_reconnect_attempts").(int),
+		KeepaliveInterval: time.Duration(d.Get("ssh_keepalive_interval").(int)) * time.Second,
+	})
+	client.closeWith(agentConns...)
+	agentConns = nil
+
+	if _, err := client.connect(ctx); err != nil {
+		client.Close()
 		log.Printf("[ERROR]: %v", err)
 		return nil, diag.Errorf("Could not establish SSH connection: %v", err)
 	}
 
-	res := run(client, "version")
+	return client, nil
+}
+
+func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	var client Executor
+	var diags diag.Diagnostics
+
+	transport := d.Get("transport").(string)
+	log.Printf("[DEBUG] transport %v\n", transport)
+
+	if transport == "local" {
+		client = NewLocalExecutor()
+	} else {
+		sshClient, sshDiags := configureSshConnection(ctx, d)
+		if sshDiags.HasError() {
+			return nil, sshDiags
+		}
+		client = sshClient
+	}
+
+	// The dokku user has dokku as its forced command, anything else needs to be
+	// told to run dokku
+	prefix := d.Get("command_prefix").(string)
+	if d.Get("use_sudo").(bool) {
+		prefix = "sudo -n dokku"
+	} else if prefix == "" && transport == "local" {
+		prefix = "dokku"
+	}
+
+	if prefix != "" {
+		log.Printf("[DEBUG] command prefix %v\n", prefix)
+		client = withCommandPrefix(client, prefix)
+	}
 
-	// Check for 127 status code... suggests that we're not authenticating
-	// with a dokku user (see https://github.com/aaronstillwell/terraform-provider-dokku/issues/1)
-	if res.status == 127 {
-		log.Printf("[ERROR] must use a dokku user for authentication, see the docs")
-		return nil, diag.Errorf("[ERROR] must use a dokku user for authentication, see the docs")
+	versionOutput, versionDiags := dokkuVersionOutput(ctx, client, prefix)
+	if versionDiags.HasError() {
+		return nil, versionDiags
 	}
 
 	re := regexp.MustCompile("[0-9]+\\.[0-9]+\\.[0-9]+")
-	found := re.FindString(res.stdout)
+	found := re.FindString(versionOutput)
 
 	hostVersion, err := semver.Parse(string(found))
 
-	DOKKU_VERSION = hostVersion
-
 	log.Printf("[DEBUG] host version %v", hostVersion)
 
-	testedVersions := ">=0.30.0 <0.36.0"
+	dokku := NewDokkuClient(client, hostVersion)
+
+	testedVersions := testedDokkuVersions()
 	testedErrMsg := fmt.Sprintf("This provider has not been tested against Dokku version %s. Tested version range: %s", string(found), testedVersions)
 
 	if err == nil {
@@ -190,18 +393,46 @@ func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}
 			log.Printf("[DEBUG] fail_on_untested_version: %v", d.Get("fail_on_untested_version").(bool))
 
 			if d.Get("fail_on_untested_version").(bool) {
-				return client, diag.Errorf(testedErrMsg)
+				return dokku, diag.Errorf(testedErrMsg)
 			}
 			warn := diag.Diagnostic{
 				Severity: diag.Warning,
 				Summary:  testedErrMsg,
 			}
 			diags = append(diags, warn)
-			return client, diags
+			return dokku, diags
 		}
 	} else {
-		return client, diag.Errorf("Could not detect dokku version - tested version range: %s", testedVersions)
+		return dokku, diag.Errorf("Could not detect dokku version - tested version range: %s", testedVersions)
+	}
+
+	return dokku, diags
+}
+
+// Run `version`, returning its output. The ways it fails when the user or the
+// command prefix is wrong are turned into diagnostics saying how to fix them.
+func dokkuVersionOutput(ctx context.Context, client Executor, prefix string) (string, diag.Diagnostics) {
+	res := run(ctx, client, "version")
+
+	if errors.Is(res.err, ErrPluginNotInstalled) {
+		if prefix == "" {
+			// Suggests that we're not authenticating with a dokku user
+			// (see https://github.com/aaronstillwell/terraform-provider-dokku/issues/1)
+			log.Printf("[ERROR] must use a dokku user for authentication, or set use_sudo/command_prefix, see the docs")
+			return "", diag.Errorf("[ERROR] must use a dokku user for authentication, or set use_sudo/command_prefix, see the docs")
+		}
+		log.Printf("[ERROR] command not found running `%s version`", prefix)
+		return "", diag.Errorf("[ERROR] command not found running `%s version`, check dokku is installed and command_prefix is correct", prefix)
+	}
+
+	if errors.Is(res.err, ErrPermissionDenied) && strings.Contains(res.stderr, "a password is required") {
+		log.Printf("[ERROR] sudo requires a password to run dokku")
+		return "", diag.Errorf("[ERROR] sudo requires a password to run dokku, passwordless sudo must be configured for the user to run dokku")
+	}
+
+	if res.err != nil {
+		return "", dokkuDiag(res.err)
 	}
 
-	return client, diags
+	return res.stdout, nil
 }
@@ -1,10 +1,17 @@
 package provider
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/blang/semver"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -19,6 +26,44 @@ func init() {
 	}
 }
 
+// Unless pointed at a real dokku host with DOKKU_SSH_HOST, the tests run against
+// an in-process fake (see fake_dokku_test.go). The acceptance tests still need a
+// terraform binary, which the SDK downloads unless TF_ACC_TERRAFORM_PATH is set,
+// so against the fake they use the one on PATH and run without TF_ACC if there
+// is one.
+func TestMain(m *testing.M) {
+	if os.Getenv("DOKKU_SSH_HOST") != "" {
+		os.Exit(m.Run())
+	}
+
+	server, err := startFakeDokkuServer(newFakeDokku(fakeDokkuVersion))
+	if err != nil {
+		log.Fatalf("could not start fake dokku server: %v", err)
+	}
+
+	dir, err := os.MkdirTemp("", "terraform-provider-dokku")
+	if err != nil {
+		log.Fatalf("could not create temp dir: %v", err)
+	}
+
+	if err := server.setEnv(dir); err != nil {
+		log.Fatalf("could not configure fake dokku server: %v", err)
+	}
+
+	if os.Getenv("TF_ACC_TERRAFORM_PATH") == "" {
+		if path, err := exec.LookPath("terraform"); err == nil {
+			os.Setenv("TF_ACC_TERRAFORM_PATH", path)
+			os.Setenv("TF_ACC", "1")
+		}
+	}
+
+	code := m.Run()
+
+	server.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestAccInlineSshKey(t *testing.T) {
 	certPath := os.Getenv("DOKKU_SSH_CERT")
 	content, _ := os.ReadFile(certPath)
@@ -128,3 +173,173 @@ func TestAccSshKeyOnDiskWithPassphraseFromEnv(t *testing.T) {
 		},
 	})
 }
+
+// Put fake dokku and sudo scripts on the PATH for the local transport to run.
+// dokku logs its arguments to the returned file, and runs the given script.
+func testLocalDokku(t *testing.T, script string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "dokku.log")
+
+	files := map[string]string{
+		"dokku": fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\n%s\n", logPath, script),
+		// Runs the command, unless FAKE_SUDO_PASSWORD is set as sudo -n does
+		// when a password is needed
+		"sudo": "#!/bin/sh\n[ \"$1\" = -n ] && shift\nif [ -n \"$FAKE_SUDO_PASSWORD\" ]; then echo 'sudo: a password is required' >&2; exit 1; fi\nexec \"$@\"\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("PATH", dir+":/usr/bin:/bin")
+	return logPath
+}
+
+func TestProviderConfigureLocal(t *testing.T) {
+	logPath := testLocalDokku(t, `echo "dokku version 0.34.0"`)
+
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"transport": "local",
+	})
+
+	meta, diags := providerConfigure(context.Background(), d)
+	if diags.HasError() {
+		t.Fatalf("configure failed: %v", diags)
+	}
+
+	client := meta.(*DokkuClient)
+	if !client.Version.Equals(semver.MustParse("0.34.0")) {
+		t.Errorf("expected the version of the local dokku, got %v", client.Version)
+	}
+
+	// Commands are run with the local dokku, without SSH
+	if _, _, err := client.Run(context.Background(), "apps:list", nil); err != nil {
+		t.Fatalf("could not run command: %v", err)
+	}
+
+	commands, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(commands) != "version\napps:list\n" {
+		t.Errorf("unexpected commands run %q", commands)
+	}
+}
+
+func TestProviderConfigureUseSudo(t *testing.T) {
+	logPath := testLocalDokku(t, `echo "dokku version 0.34.0"`)
+
+	d := schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"transport": "local",
+		"use_sudo":  true,
+	})
+
+	meta, diags := providerConfigure(context.Background(), d)
+	if diags.HasError() {
+		t.Fatalf("configure failed: %v", diags)
+	}
+
+	recorder := &recordingExecutor{}
+	meta.(*DokkuClient).Executor.(*prefixedExecutor).Executor = recorder
+	meta.(*DokkuClient).Run(context.Background(), "apps:list", nil)
+
+	if len(recorder.cmds) != 1 || recorder.cmds[0] != "sudo -n dokku apps:list" {
+		t.Errorf("expected commands to be run with sudo, got %q", recorder.cmds)
+	}
+
+	commands, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(commands) != "version\n" {
+		t.Errorf("expected the version to be read through sudo, got %q", commands)
+	}
+}
+
+func TestProviderConfigureDiagnostics(t *testing.T) {
+	cases := []struct {
+		name   string
+		config map[string]interface{}
+		// the fake dokku script, or empty for dokku not to be installed
+		script   string
+		env      map[string]string
+		severity diag.Severity
+		summary  string
+	}{
+		{
+			name:     "dokku not installed",
+			config:   map[string]interface{}{"transport": "local"},
+			severity: diag.Error,
+			summary:  "command not found running `dokku version`",
+		},
+		{
+			name:     "wrong command prefix",
+			config:   map[string]interface{}{"transport": "local", "command_prefix": "/opt/dokku/bin/dokku"},
+			script:   `echo "dokku version 0.34.0"`,
+			severity: diag.Error,
+			summary:  "command not found running `/opt/dokku/bin/dokku version`",
+		},
+		{
+			name:     "sudo needs a password",
+			config:   map[string]interface{}{"transport": "local", "use_sudo": true},
+			script:   `echo "dokku version 0.34.0"`,
+			env:      map[string]string{"FAKE_SUDO_PASSWORD": "1"},
+			severity: diag.Error,
+			summary:  "sudo requires a password to run dokku",
+		},
+		{
+			name:     "version fails",
+			config:   map[string]interface{}{"transport": "local"},
+			script:   `echo " !     Something went wrong" >&2; exit 1`,
+			severity: diag.Error,
+			summary:  "Something went wrong",
+		},
+		{
+			name:     "untested version",
+			config:   map[string]interface{}{"transport": "local", "fail_on_untested_version": false},
+			script:   `echo "dokku version 0.20.0"`,
+			severity: diag.Warning,
+			summary:  "has not been tested against Dokku version 0.20.0",
+		},
+		{
+			name:     "untested version failing",
+			config:   map[string]interface{}{"transport": "local"},
+			script:   `echo "dokku version 0.20.0"`,
+			severity: diag.Error,
+			summary:  "has not been tested against Dokku version 0.20.0",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			testLocalDokku(t, c.script)
+			if c.script == "" {
+				t.Setenv("PATH", t.TempDir()+":/usr/bin:/bin")
+			}
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+
+			_, diags := providerConfigure(context.Background(), schema.TestResourceDataRaw(t, Provider().Schema, c.config))
+
+			if len(diags) != 1 {
+				t.Fatalf("expected a single diagnostic, got %v", diags)
+			}
+			if diags[0].Severity != c.severity || !strings.Contains(diags[0].Summary, c.summary) {
+				t.Errorf("expected a diagnostic containing %q, got %v", c.summary, diags[0])
+			}
+		})
+	}
+}
+
+// A user without dokku as its forced command runs `version` in their shell
+func TestDokkuVersionOutputNotDokkuUser(t *testing.T) {
+	_, diags := dokkuVersionOutput(context.Background(), NewLocalExecutor(), "")
+
+	if !diags.HasError() || !strings.Contains(diags[0].Summary, "must use a dokku user") {
+		t.Errorf("expected a diagnostic about the user, got %v", diags)
+	}
+}
@@ -3,11 +3,13 @@ package provider
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
-	"github.com/melbahja/goph"
 )
 
 func resourceApp() *schema.Resource {
@@ -17,18 +19,25 @@ func resourceApp() *schema.Resource {
 		ReadContext:   appRead,
 		UpdateContext: appUpdate,
 		DeleteContext: appDelete,
+		CustomizeDiff: appCustomizeDiff,
+		// Creating or updating an app with git_sync can build it, so allow as
+		// long as dokku_app_deploy does
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"name": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
 				Description: "The name of the Dokku application.",
 			},
-			// TODO: locked support
 			"locked": &schema.Schema{
 				Type:     schema.TypeBool,
 				Default:  false,
 				Optional: true,
-				Description: "(Not yet implemented) Whether the application is locked for deployment. When true, deploys to this application will be blocked.",
+				Description: "Whether the application is locked for deployment. When true, deploys to this application will be blocked.",
 			},
 			"config_vars": &schema.Schema{
 				Type: schema.TypeMap,
@@ -56,6 +65,32 @@ func resourceApp() *schema.Resource {
 				Optional: true,
 				Description: "List of buildpacks to be used when deploying the application. These can be URLs to custom buildpacks or shorthand names for official Heroku buildpacks.",
 			},
+			"builder": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice(dokkuBuilders, false),
+				Description: "The builder to build the app with, one of " + quotedList(dokkuBuilders) + ". When not set, dokku picks one based on the app's source e.g the dockerfile builder for apps with a `Dockerfile`.",
+			},
+			"build_dir": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Description: "The directory in the app's repository to build the app from, for apps in a subdirectory of a monorepo. Defaults to the root of the repository.",
+			},
+			"dockerfile_path": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Description: "The path to the app's Dockerfile, relative to the build directory, for the dockerfile builder. Defaults to `Dockerfile`.",
+			},
+			"projecttoml_path": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Description: "The path to the app's `project.toml`, relative to the build directory, for the pack (Cloud Native Buildpacks) builder. Defaults to `project.toml`.",
+			},
+			"nixpackstoml_path": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				Description: "The path to the app's `nixpacks.toml`, relative to the build directory, for the nixpacks builder. Defaults to `nixpacks.toml`. Requires dokku 0.33.0 or later.",
+			},
 			"ports": &schema.Schema{
 				Type: schema.TypeSet,
 				Elem: &schema.Schema{
@@ -75,6 +110,18 @@ func resourceApp() *schema.Resource {
 				// 	return []string{}, errs
 				// },
 			},
+			"proxy_type": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice(dokkuProxyTypes, false),
+				Description: "The proxy implementation the app uses, one of " + quotedList(dokkuProxyTypes) + ". Defaults to the host's global proxy type, which the app goes back to when this is removed. The `nginx` properties and template only apply to apps using nginx, and aren't read or set for apps using another proxy.",
+			},
+			"proxy_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+				Description: "Whether the app's proxy is enabled. When disabled, the app's web processes are exposed on random ports rather than behind the proxy. When not set, the proxy is left as it is.",
+			},
 			"nginx_bind_address_ipv4": {
 				Type:         schema.TypeString,
 				Optional:     true,
@@ -89,6 +136,150 @@ func resourceApp() *schema.Resource {
 				ValidateFunc: validation.IsIPv6Address,
 				Description: "The IPv6 address that nginx will bind to for this application. Defaults to '::'.",
 			},
+			"nginx": &schema.Schema{
+				Type: schema.TypeMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional:         true,
+				ValidateDiagFunc: validateNginxProperties,
+				Description: "nginx properties to set for the application, e.g `{ client-max-body-size = \"50m\" }`. Any of " + quotedList(dokkuNginxProperties) + ". Properties set outside of terraform are left alone, and changes are applied to deployed apps with `proxy:build-config`.",
+			},
+			"nginx_conf_sigil_path": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateRelativePath,
+				Description: "The path of a custom `nginx.conf.sigil` template relative to the root of the app's source (defaults to `nginx.conf.sigil`), which dokku reads when the app is deployed.",
+			},
+			"nginx_config": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: "The app's rendered nginx config, from `nginx:show-config`. Only read when `nginx` or `nginx_conf_sigil_path` is set, and empty until the app is deployed.",
+			},
+			"process_scale": &schema.Schema{
+				Type: schema.TypeMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeInt,
+				},
+				Optional: true,
+				Description: "Number of processes to run for each process type, e.g `{ web = 3, worker = 2 }`. Process types not listed are left at their current scale.",
+			},
+			"checks": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Description: "Zero downtime deploy checks, which are enabled for all process types by default. Removing the block returns the checks to dokku's defaults. The attempts and timeout can't be set with `checks:set`, so are set in the `healthchecks` entry of the app's `app.json` instead.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"disabled": {
+							Type:        schema.TypeSet,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Process types to disable checks for, or `_all_`. Their containers are stopped before the new ones start, so there's downtime on deploy.",
+						},
+						"skipped": {
+							Type:        schema.TypeSet,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Process types to skip checks for, or `_all_`. The new containers replace the old ones without being checked first.",
+						},
+						"wait_to_retire": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validation.IntAtLeast(0),
+							Description:  "How long, in seconds, to wait before stopping the old containers after a deploy, e.g to let workers finish their jobs. Defaults to dokku's default of 60.",
+						},
+					},
+				},
+			},
+			"docker_options": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Description: "Options passed to docker for each phase of the app's lifecycle. Options should be written as dokku shows them in `docker-options:report`, e.g `-v /var/lib/dokku/data/storage/app:/data`. Options set outside of terraform are left alone.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"build": {
+							Type:        schema.TypeSet,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Options used when building the app's image.",
+						},
+						"deploy": {
+							Type:        schema.TypeSet,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Options used when running the app's processes.",
+						},
+						"run": {
+							Type:        schema.TypeSet,
+							Optional:    true,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "Options used for one-off containers, e.g `dokku run`.",
+						},
+					},
+				},
+			},
+			"git_sync": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Description: "A git repository to sync the app's code from with `git:sync`. The app is synced when created, and again whenever the remote or ref changes, so pin a tag or commit sha in `ref` to control what's deployed.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"remote": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "The URL of the git repository, e.g `https://github.com/dokku/smoke-test-app.git`. The Dokku host must be able to clone it.",
+						},
+						"ref": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "The branch, tag or commit sha to sync. Defaults to the repository's default branch.",
+						},
+						"build": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     true,
+							Description: "Whether to build and deploy the app after syncing.",
+						},
+					},
+				},
+			},
+			"git_sha": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+				Description: "The sha of the commit the app was last deployed from, from `git:report`. Only read when `git_sync` is set.",
+			},
+			"resources": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Description: "Resource limits & reservations for a process type. These take effect the next time the app is deployed.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"process_type": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     defaultProcessType,
+							Description: "The process type to apply the resources to. Defaults to `_default_`, which applies to all process types without their own.",
+						},
+						"limit": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							MaxItems:    1,
+							Elem:        appResourceValuesSchema(),
+							Description: "The maximum resources the process type can use. At least one must be set.",
+						},
+						"reserve": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							MaxItems:    1,
+							Elem:        appResourceValuesSchema(),
+							Description: "The resources reserved for the process type. At least one must be set.",
+						},
+					},
+				},
+			},
 		},
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
@@ -96,20 +287,50 @@ func resourceApp() *schema.Resource {
 	}
 }
 
+// Checks that span blocks, and the computed attributes that changes recompute
+func appCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if err := validateAppResources(d.Get("resources").(*schema.Set)); err != nil {
+		return err
+	}
+
+	if d.Id() == "" {
+		return nil
+	}
+
+	// A sync deploys a new commit, changing the sha
+	if d.HasChange("git_sync.0.remote") || d.HasChange("git_sync.0.ref") {
+		if err := d.SetNewComputed("git_sha"); err != nil {
+			return err
+		}
+	}
+
+	// As does changing the app's nginx config or template, or the proxy it uses
+	if d.HasChange("nginx") || d.HasChange("nginx_conf_sigil_path") || d.HasChange("proxy_type") {
+		if err := d.SetNewComputed("nginx_config"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func appCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
 	app := NewDokkuAppFromResourceData(d)
 
-	err := dokkuAppCreate(app, sshClient)
+	err := dokkuAppCreate(ctx, app, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
-	app, err = dokkuAppRetrieve(app.Name, sshClient)
+	app, err = dokkuAppRetrieve(ctx, app.Name, sshClient, d)
+	if err != nil {
+		return dokkuDiag(err)
+	}
 	app.setOnResourceData(d)
 
 	return diags
@@ -117,7 +338,7 @@ func appCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.
 
 //
 func appRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
@@ -128,9 +349,9 @@ func appRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Di
 		appName = d.Get("name").(string)
 	}
 
-	app, err := dokkuAppRetrieve(appName, sshClient)
+	app, err := dokkuAppRetrieve(ctx, appName, sshClient, d)
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 	app.setOnResourceData(d)
 
@@ -142,10 +363,31 @@ func appUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.
 	var diags diag.Diagnostics
 
 	app := NewDokkuAppFromResourceData(d)
-	err := dokkuAppUpdate(app, d, m.(*goph.Client))
+	err := dokkuAppUpdate(ctx, app, d, m.(*DokkuClient))
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
+	}
+
+	if d.HasChange("git_sync") {
+		gitReport, err := readAppGitReport(ctx, app.Name, m.(*DokkuClient))
+		if err != nil {
+			return dokkuDiag(err)
+		}
+		d.Set("git_sha", gitReport["Git sha"])
+	}
+
+	// The config was rebuilt, so read it back rather than leaving it unknown
+	// until the next refresh
+	if d.HasChanges("nginx", "nginx_conf_sigil_path", "proxy_type") {
+		nginxConfig := ""
+		if app.usesNginx() {
+			nginxConfig, err = readAppNginxConfig(ctx, app.Name, m.(*DokkuClient))
+			if err != nil {
+				return dokkuDiag(err)
+			}
+		}
+		d.Set("nginx_config", nginxConfig)
 	}
 
 	d.SetId(d.Get("name").(string))
@@ -155,16 +397,98 @@ func appUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.
 
 //
 func appDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
 	appName := d.Get("name").(string)
 
-	res := run(sshClient, fmt.Sprintf("apps:destroy %s --force", appName))
+	res := run(ctx, sshClient, fmt.Sprintf("apps:destroy %s --force", appName))
 
 	if res.err != nil {
-		return diag.FromErr(res.err)
+		return dokkuDiag(res.err)
+	}
+
+	return diags
+}
+
+// The resources that can be limited or reserved for a process type, see
+// dokkuResourceTypes
+func appResourceValuesSchema() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"cpu": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Number of CPUs, e.g `1.5`.",
+			},
+			"memory": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Amount of memory, with a unit, e.g `512m` or `2g`.",
+			},
+			"memory_swap": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Amount of swap, with a unit, e.g `1g`.",
+			},
+			"nvidia_gpu": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Number of Nvidia GPUs.",
+			},
+		},
+	}
+}
+
+// For listing the allowed values in descriptions
+func quotedList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, "`"+value+"`")
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Dokku never treats paths to files in the app's repository as absolute
+func validateRelativePath(value interface{}, key string) ([]string, []error) {
+	if strings.HasPrefix(value.(string), "/") {
+		return nil, []error{fmt.Errorf("%s must be a path relative to the root of the app's repository, got %s", key, value)}
+	}
+	return nil, nil
+}
+
+// An empty limit or reserve block would read back as no block at all, so a
+// permanent diff. They can't be caught by a ValidateFunc as those don't run on
+// blocks.
+func validateAppResources(resources *schema.Set) error {
+	for _, r := range resources.List() {
+		block := r.(map[string]interface{})
+
+		for _, kind := range []string{"limit", "reserve"} {
+			blocks := block[kind].([]interface{})
+			if len(blocks) > 0 && len(resourceValuesFromResourceData(blocks)) == 0 {
+				return fmt.Errorf("the %s block for process type %s must set at least one of %s", kind, block["process_type"], quotedList(sortedKeys(appResourceValuesSchema().Schema)))
+			}
+		}
+	}
+	return nil
+}
+
+func validateNginxProperties(value interface{}, path cty.Path) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	valid := sliceToLookupMap(dokkuNginxProperties)
+
+	for _, property := range sortedKeys(value.(map[string]interface{})) {
+		if _, ok := valid[property]; !ok {
+			diags = append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Unsupported nginx property %s", property),
+				Detail:        fmt.Sprintf("Expected one of %s", strings.Join(dokkuNginxProperties, ", ")),
+				AttributePath: append(path, cty.IndexStep{Key: cty.StringVal(property)}),
+			})
+		}
 	}
 
 	return diags
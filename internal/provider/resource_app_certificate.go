@@ -0,0 +1,223 @@
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceAppCertificate() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Adds a TLS certificate for a Dokku application, e.g a wildcard certificate issued outside of Dokku. The certificate and key are uploaded with `certs:add`, and replaced in place with `certs:update` when they change. Use `dokku_letsencrypt` instead to have Dokku issue certificates. Dokku can't give back an uploaded certificate or key, so after importing one the first apply uploads them again with `certs:update`.",
+		CreateContext: resourceAppCertificateCreate,
+		ReadContext:   resourceAppCertificateRead,
+		UpdateContext: resourceAppCertificateUpdate,
+		DeleteContext: resourceAppCertificateDelete,
+		CustomizeDiff: resourceAppCertificateCustomizeDiff,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+		Schema: map[string]*schema.Schema{
+			"app": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the Dokku application to add the certificate to.",
+			},
+			"certificate": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Sensitive:   true,
+				Description: "The PEM encoded certificate, followed by any intermediate certificates.",
+			},
+			"private_key": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Sensitive:   true,
+				Description: "The PEM encoded private key of the certificate. It must not be encrypted.",
+			},
+			"issuer": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The issuer of the certificate, as reported by `certs:report`.",
+			},
+			"expiry": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "When the certificate expires, as reported by `certs:report` e.g `Jul 19 12:12:12 2024 GMT`.",
+			},
+			"hostnames": {
+				Type: schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Computed:    true,
+				Description: "The hostnames the certificate is valid for (its subject alternative names), as reported by `certs:report`.",
+			},
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+	}
+}
+
+type DokkuAppCertificate struct {
+	Enabled   bool
+	Issuer    string
+	Expiry    string
+	Hostnames []string
+}
+
+func readAppCertificate(ctx context.Context, appName string, client *DokkuClient) (*DokkuAppCertificate, error) {
+	res := run(ctx, client, fmt.Sprintf("certs:report %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	report := parseKeyValues(strings.Split(res.stdout, "\n")[1:])
+
+	cert := &DokkuAppCertificate{
+		Enabled:   report["Ssl enabled"] == "true",
+		Issuer:    report["Ssl issuer"],
+		Expiry:    report["Ssl expires at"],
+		Hostnames: strings.Fields(report["Ssl hostnames"]),
+	}
+
+	return cert, nil
+}
+
+// certs:add & certs:update read a tarball containing server.crt and
+// server.key from stdin
+func appCertificateTarball(certificate string, privateKey string) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"server.crt", certificate},
+		{"server.key", privateKey},
+	}
+
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    file.name,
+			Mode:    0600,
+			Size:    int64(len(file.content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(file.content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
+
+// Upload the certificate with certs:add, or certs:update to replace one
+func dokkuAppCertificateSet(ctx context.Context, d *schema.ResourceData, subcommand string, client *DokkuClient) error {
+	tarball, err := appCertificateTarball(d.Get("certificate").(string), d.Get("private_key").(string))
+	if err != nil {
+		return err
+	}
+
+	return runWithStdin(ctx, client, fmt.Sprintf("certs:%s %s", subcommand, d.Get("app").(string)), tarball).err
+}
+
+// The details read back from dokku change along with the certificate
+func resourceAppCertificateCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if d.Id() == "" || !d.HasChange("certificate") {
+		return nil
+	}
+
+	for _, key := range []string{"issuer", "expiry", "hostnames"} {
+		if err := d.SetNewComputed(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceAppCertificateCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	if err := dokkuAppCertificateSet(ctx, d, "add", sshClient); err != nil {
+		return dokkuDiag(err)
+	}
+
+	d.SetId(d.Get("app").(string))
+
+	return resourceAppCertificateRead(ctx, d, m)
+}
+
+func resourceAppCertificateRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	var diags diag.Diagnostics
+
+	cert, err := readAppCertificate(ctx, d.Id(), sshClient)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			d.SetId("")
+			return diags
+		}
+		return dokkuDiag(err)
+	}
+
+	if !cert.Enabled {
+		d.SetId("")
+		return diags
+	}
+
+	d.Set("app", d.Id())
+	d.Set("issuer", cert.Issuer)
+	d.Set("expiry", cert.Expiry)
+	d.Set("hostnames", cert.Hostnames)
+
+	return diags
+}
+
+func resourceAppCertificateUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	if d.HasChanges("certificate", "private_key") {
+		if err := dokkuAppCertificateSet(ctx, d, "update", sshClient); err != nil {
+			return dokkuDiag(err)
+		}
+	}
+
+	return resourceAppCertificateRead(ctx, d, m)
+}
+
+func resourceAppCertificateDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	var diags diag.Diagnostics
+
+	res := run(ctx, sshClient, fmt.Sprintf("certs:remove %s", d.Get("app").(string)))
+
+	if res.err != nil && !errors.Is(res.err, ErrNotFound) {
+		return dokkuDiag(res.err)
+	}
+
+	return diags
+}
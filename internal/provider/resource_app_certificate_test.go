@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestAccAppCertificate(t *testing.T) {
+	appName := fmt.Sprintf("cert-app-%s", acctest.RandString(10))
+	cert, key := testSelfSignedCertificate(t, "*.dokku.me", "dokku.me")
+	newCert, newKey := testSelfSignedCertificate(t, "*.dokku.me")
+
+	config := func(cert string, key string) string {
+		return fmt.Sprintf(`
+resource "dokku_app" "test" {
+	name = "%s"
+}
+
+resource "dokku_app_certificate" "test" {
+	app = dokku_app.test.name
+	certificate = <<EOT
+%sEOT
+	private_key = <<EOT
+%sEOT
+}
+`, appName, cert, key)
+	}
+
+	resource.Test(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDokkuAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config(cert, key),
+				Check: resource.ComposeTestCheckFunc(
+					testAccAppCertificateEnabled(appName, true),
+					resource.TestCheckResourceAttr("dokku_app_certificate.test", "hostnames.#", "2"),
+					resource.TestCheckResourceAttr("dokku_app_certificate.test", "hostnames.0", "*.dokku.me"),
+					resource.TestCheckResourceAttrSet("dokku_app_certificate.test", "issuer"),
+					resource.TestCheckResourceAttrSet("dokku_app_certificate.test", "expiry"),
+				),
+			},
+			{
+				ResourceName:      "dokku_app_certificate.test",
+				ImportState:       true,
+				ImportStateVerify: true,
+				// The certificate & key can't be read back from dokku
+				ImportStateVerifyIgnore: []string{"certificate", "private_key"},
+			},
+			{
+				Config: config(newCert, newKey),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("dokku_app_certificate.test", "hostnames.#", "1"),
+				),
+			},
+			{
+				Config: fmt.Sprintf(`
+resource "dokku_app" "test" {
+	name = "%s"
+}
+`, appName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccAppCertificateEnabled(appName, false),
+				),
+			},
+		},
+	})
+}
+
+// A PEM encoded self signed certificate & key for the hostnames
+func testSelfSignedCertificate(t *testing.T, hostnames ...string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hostnames[0], Organization: []string{"Dokku Test"}},
+		DNSNames:     hostnames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	return string(cert), string(keyPem)
+}
+
+func testAccAppCertificateEnabled(appName string, enabled bool) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		sshClient := testAccProvider.Meta().(*DokkuClient)
+
+		cert, err := readAppCertificate(context.Background(), appName, sshClient)
+		if err != nil {
+			return err
+		}
+
+		if cert.Enabled != enabled {
+			return fmt.Errorf("expected ssl enabled for app %s to be %t", appName, enabled)
+		}
+		return nil
+	}
+}
+
+func TestAppCertificateLifecycle(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	dokku.Exec("apps:create test-app")
+
+	cert, key := testSelfSignedCertificate(t, "*.dokku.me", "dokku.me")
+
+	d := schema.TestResourceDataRaw(t, resourceAppCertificate().Schema, map[string]interface{}{
+		"app":         "test-app",
+		"certificate": cert,
+		"private_key": key,
+	})
+
+	if diags := resourceAppCertificateCreate(ctx, d, client); diags.HasError() {
+		t.Fatalf("create failed: %v", diags)
+	}
+
+	if !reflect.DeepEqual(d.Get("hostnames"), []interface{}{"*.dokku.me", "dokku.me"}) {
+		t.Errorf("unexpected hostnames %v", d.Get("hostnames"))
+	}
+
+	if d.Get("issuer").(string) != "CN=*.dokku.me,O=Dokku Test" {
+		t.Errorf("unexpected issuer %v", d.Get("issuer"))
+	}
+
+	expiry := dokku.apps["test-app"].cert.NotAfter.UTC().Format("Jan _2 15:04:05 2006 GMT")
+	if d.Get("expiry").(string) != expiry {
+		t.Errorf("expected expiry %s, got %v", expiry, d.Get("expiry"))
+	}
+
+	if diags := resourceAppCertificateDelete(ctx, d, client); diags.HasError() {
+		t.Fatalf("delete failed: %v", diags)
+	}
+
+	if diags := resourceAppCertificateRead(ctx, d, client); diags.HasError() || d.Id() != "" {
+		t.Errorf("expected removed certificate to be removed from state, %v", diags)
+	}
+}
@@ -0,0 +1,367 @@
+package provider
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceAppDeploy() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Deploys a Docker image to a Dokku application with `git:from-image`, or the app's source from a directory or tarball on the machine running terraform with `tar:in`, redeploying whenever either changes. If an image deploy is replaced some other way (e.g a `git push`), the image is deployed again on the next apply. Destroying this resource leaves the app running.",
+		CreateContext: resourceAppDeployCreate,
+		ReadContext:   resourceAppDeployRead,
+		UpdateContext: resourceAppDeployUpdate,
+		DeleteContext: resourceAppDeployDelete,
+		CustomizeDiff: resourceAppDeployCustomizeDiff,
+		// Deploys are slow, as dokku waits for the new containers to pass their
+		// checks
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+		},
+		Schema: map[string]*schema.Schema{
+			"app": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the Dokku application to deploy to.",
+			},
+			"image": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ExactlyOneOf: []string{"image", "source_path"},
+				Description:  "The image to deploy, e.g `registry.example.com/app:1.2.3`. Reference the image by digest (`app@sha256:...`) to pin exactly what's running, as Dokku doesn't report the digest of images deployed by tag.",
+			},
+			"source_path": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ExactlyOneOf: []string{"image", "source_path"},
+				Description:  "The path of a directory, or a `.tar`, `.tar.gz` or `.tgz` archive, on the machine running terraform to deploy the app's source from, e.g the output of a build step. It's streamed to Dokku over the provider's connection with `tar:in` and built as a push would be. It's deployed again whenever its contents change, but Dokku doesn't record where a tarball came from, so deploys made outside of terraform aren't detected.",
+			},
+			"source_hash": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The SHA256 hash of the contents of `source_path` when it was last deployed, used to detect changes to it.",
+			},
+			"sha": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The sha of the commit Dokku created in the app's repository for the deploy, from `git:report`. This isn't the image's digest, which Dokku doesn't report.",
+			},
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+	}
+}
+
+func dokkuAppDeployImage(ctx context.Context, appName string, image string, client *DokkuClient) error {
+	return run(ctx, client, fmt.Sprintf("git:from-image %s %s", appName, shellescape.Quote(image))).err
+}
+
+// Stream the source to tar:in as a tarball, which dokku builds like a push
+func dokkuAppDeploySource(ctx context.Context, appName string, sourcePath string, client *DokkuClient) error {
+	tarball, err := appSourceTarball(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer tarball.Close()
+
+	return runWithStdin(ctx, client, fmt.Sprintf("tar:in %s", appName), tarball).err
+}
+
+// The tarballs tar:in is given are always uncompressed
+func isGzipArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// The source as a tarball, read from the archive or written from the directory
+// as it's read. Closing it stops any writing that's left.
+func appSourceTarball(sourcePath string) (io.ReadCloser, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read source_path: %v", err)
+	}
+
+	if !info.IsDir() {
+		file, err := os.Open(sourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read source_path: %v", err)
+		}
+		if !isGzipArchive(sourcePath) {
+			return file, nil
+		}
+
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Could not read source_path: %v", err)
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{gz, file}, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeAppSourceTarball(pw, sourcePath))
+	}()
+
+	return pr, nil
+}
+
+// Write the directory's contents to a tarball, with paths relative to it
+func writeAppSourceTarball(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+
+	err := walkAppSource(dir, func(rel string, path string, info fs.FileInfo) error {
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			var err error
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// Call fn for everything in the directory (but not the directory itself), in
+// a stable order, with its path relative to the directory
+func walkAppSource(dir string, fn func(rel string, path string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		return fn(filepath.ToSlash(rel), path, info)
+	})
+}
+
+// A hash of the source's contents. Archives are hashed as they are, and
+// directories by the path, type and content of everything in them, so that
+// timestamps don't cause a redeploy.
+func appSourceHash(sourcePath string) (string, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("Could not read source_path: %v", err)
+	}
+
+	hash := sha256.New()
+
+	if !info.IsDir() {
+		file, err := os.Open(sourcePath)
+		if err != nil {
+			return "", fmt.Errorf("Could not read source_path: %v", err)
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", fmt.Errorf("Could not read source_path: %v", err)
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	err = walkAppSource(sourcePath, func(rel string, path string, info fs.FileInfo) error {
+		fmt.Fprintf(hash, "%s\x00%s\x00", rel, info.Mode().Type())
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s\x00", link)
+		case info.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			if _, err := io.Copy(hash, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("Could not read source_path: %v", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Deploy whichever of the image or source is set, keeping the hash of the
+// source that was deployed
+func dokkuAppDeploy(ctx context.Context, d *schema.ResourceData, client *DokkuClient) error {
+	appName := d.Get("app").(string)
+
+	sourcePath := d.Get("source_path").(string)
+	if sourcePath == "" {
+		d.Set("source_hash", "")
+		return dokkuAppDeployImage(ctx, appName, d.Get("image").(string), client)
+	}
+
+	hash, err := appSourceHash(sourcePath)
+	if err != nil {
+		return err
+	}
+
+	if err := dokkuAppDeploySource(ctx, appName, sourcePath, client); err != nil {
+		return err
+	}
+
+	d.Set("source_hash", hash)
+	return nil
+}
+
+// Changes to the source are found by hashing it, and a new deploy means a new
+// commit
+func resourceAppDeployCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	sourcePath := d.Get("source_path").(string)
+
+	switch {
+	case !d.NewValueKnown("source_path"):
+		if err := d.SetNewComputed("source_hash"); err != nil {
+			return err
+		}
+	case sourcePath != "":
+		hash, err := appSourceHash(sourcePath)
+		if err != nil {
+			return err
+		}
+		if hash != d.Get("source_hash").(string) {
+			if err := d.SetNew("source_hash", hash); err != nil {
+				return err
+			}
+		}
+	case d.Get("source_hash").(string) != "":
+		if err := d.SetNew("source_hash", ""); err != nil {
+			return err
+		}
+	}
+
+	if d.Id() != "" && (d.HasChange("image") || d.HasChange("source_hash")) {
+		return d.SetNewComputed("sha")
+	}
+	return nil
+}
+
+func resourceAppDeployCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	if err := dokkuAppDeploy(ctx, d, sshClient); err != nil {
+		return dokkuDiag(err)
+	}
+
+	d.SetId(d.Get("app").(string))
+
+	return resourceAppDeployRead(ctx, d, m)
+}
+
+func resourceAppDeployRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	var diags diag.Diagnostics
+
+	report, err := readAppGitReport(ctx, d.Id(), sshClient)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			d.SetId("")
+			return diags
+		}
+		return dokkuDiag(err)
+	}
+
+	// A different image (or none, after a git push) means the app has been
+	// deployed outside of terraform, which the diff on image will undo. There's
+	// no telling where a source deploy came from, so those are left alone.
+	d.Set("app", d.Id())
+	if d.Get("source_path").(string) == "" {
+		d.Set("image", report["Git source image"])
+	}
+	d.Set("sha", report["Git sha"])
+
+	return diags
+}
+
+func resourceAppDeployUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	if d.HasChanges("image", "source_hash") {
+		if err := dokkuAppDeploy(ctx, d, sshClient); err != nil {
+			return dokkuDiag(err)
+		}
+	}
+
+	return resourceAppDeployRead(ctx, d, m)
+}
+
+// There's no undoing a deploy, so the app is left as it is
+func resourceAppDeployDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId("")
+
+	return diags
+}
@@ -0,0 +1,263 @@
+package provider
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestAccAppDeploy(t *testing.T) {
+	appName := fmt.Sprintf("deploy-app-%s", acctest.RandString(10))
+
+	config := func(image string) string {
+		return fmt.Sprintf(`
+resource "dokku_app" "test" {
+	name = "%s"
+}
+
+resource "dokku_app_deploy" "test" {
+	app = dokku_app.test.name
+	image = "%s"
+}
+`, appName, image)
+	}
+
+	resource.Test(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDokkuAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config("dokku/node-js-getting-started:latest"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccAppDeployedImage(appName, "dokku/node-js-getting-started:latest"),
+					resource.TestCheckResourceAttrSet("dokku_app_deploy.test", "sha"),
+				),
+			},
+			{
+				ResourceName:      "dokku_app_deploy.test",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				Config: config("dokku/python-getting-started:latest"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccAppDeployedImage(appName, "dokku/python-getting-started:latest"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccAppDeploySource(t *testing.T) {
+	appName := fmt.Sprintf("deploy-source-%s", acctest.RandString(10))
+
+	dir := t.TempDir()
+	dockerfile := func(image string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM "+image+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := fmt.Sprintf(`
+resource "dokku_app" "test" {
+	name = "%s"
+}
+
+resource "dokku_app_deploy" "test" {
+	app = dokku_app.test.name
+	source_path = "%s"
+}
+`, appName, dir)
+
+	var hash string
+
+	resource.Test(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDokkuAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				PreConfig: func() { dockerfile("dokku/node-js-getting-started:latest") },
+				Config:    config,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckDokkuAppExists("dokku_app.test"),
+					resource.TestCheckResourceAttrSet("dokku_app_deploy.test", "source_hash"),
+					func(s *terraform.State) error {
+						hash = s.RootModule().Resources["dokku_app_deploy.test"].Primary.Attributes["source_hash"]
+						return nil
+					},
+				),
+			},
+			{
+				PreConfig: func() { dockerfile("dokku/python-getting-started:latest") },
+				Config:    config,
+				Check: func(s *terraform.State) error {
+					if s.RootModule().Resources["dokku_app_deploy.test"].Primary.Attributes["source_hash"] == hash {
+						return fmt.Errorf("expected the source_hash to change along with the source")
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func testAccAppDeployedImage(appName string, image string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		sshClient := testAccProvider.Meta().(*DokkuClient)
+
+		report, err := readAppGitReport(context.Background(), appName, sshClient)
+		if err != nil {
+			return err
+		}
+
+		if report["Git source image"] != image {
+			return fmt.Errorf("expected app %s to be deployed from %s, got %s", appName, image, report["Git source image"])
+		}
+		return nil
+	}
+}
+
+func TestAppDeploySource(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	dokku.Exec("apps:create test-app")
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"Procfile":       []byte("web: ./server"),
+		"public/app.css": []byte("body {}"),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceAppDeploy().Schema, map[string]interface{}{
+		"app":         "test-app",
+		"source_path": dir,
+	})
+
+	if diags := resourceAppDeployCreate(ctx, d, client); diags.HasError() {
+		t.Fatalf("deploy failed: %v", diags)
+	}
+
+	if !reflect.DeepEqual(dokku.apps["test-app"].source, files) {
+		t.Errorf("expected the directory to be deployed, got %v", dokku.apps["test-app"].source)
+	}
+	if !dokku.apps["test-app"].deployed {
+		t.Errorf("expected the app to be deployed")
+	}
+
+	hash := d.Get("source_hash").(string)
+	if hash == "" {
+		t.Errorf("expected the source's hash to be kept")
+	}
+	if d.Get("image").(string) != "" {
+		t.Errorf("expected no image for a source deploy, got %v", d.Get("image"))
+	}
+
+	// Only changes to the contents are planned as a redeploy
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{"app": "test-app", "source_path": dir})
+
+	now := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "Procfile"), now, now); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := resourceAppDeploy().Diff(ctx, d.State(), config, client)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !diff.Empty() {
+		t.Errorf("expected touching a file not to plan a redeploy, got %v", diff)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "Procfile"), []byte("web: ./server --port $PORT"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = resourceAppDeploy().Diff(ctx, d.State(), config, client)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	state, diags := resourceAppDeploy().Apply(ctx, d.State(), diff, client)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %v", diags)
+	}
+	if state.Attributes["source_hash"] == hash {
+		t.Errorf("expected changing a file to change the hash")
+	}
+	if string(dokku.apps["test-app"].source["Procfile"]) != "web: ./server --port $PORT" {
+		t.Errorf("expected the changed directory to be deployed, got %v", dokku.apps["test-app"].source)
+	}
+
+	// Archives are decompressed before being streamed to tar:in
+	archive, err := os.Create(filepath.Join(t.TempDir(), "app.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(archive)
+	if err := writeAppSourceTarball(gz, dir); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	archive.Close()
+
+	dokku.apps["test-app"].source = nil
+	if err := dokkuAppDeploySource(ctx, "test-app", archive.Name(), client); err != nil {
+		t.Fatalf("deploying the archive failed: %v", err)
+	}
+	if string(dokku.apps["test-app"].source["public/app.css"]) != "body {}" {
+		t.Errorf("expected the archive to be deployed, got %v", dokku.apps["test-app"].source)
+	}
+
+	if err := dokkuAppDeploySource(ctx, "test-app", filepath.Join(dir, "missing"), client); err == nil {
+		t.Errorf("expected deploying a missing source_path to fail")
+	}
+}
+
+func TestAppDeployImage(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	dokku.Exec("apps:create test-app")
+
+	d := schema.TestResourceDataRaw(t, resourceAppDeploy().Schema, map[string]interface{}{
+		"app":   "test-app",
+		"image": "dokku/node-js-getting-started:latest",
+	})
+
+	if diags := resourceAppDeployCreate(ctx, d, client); diags.HasError() {
+		t.Fatalf("deploy failed: %v", diags)
+	}
+
+	if d.Get("sha").(string) == "" || d.Get("sha").(string) != dokku.apps["test-app"].gitSha {
+		t.Errorf("unexpected sha %v", d.Get("sha"))
+	}
+
+	// Deployed outside of terraform
+	dokku.Exec("git:from-image test-app dokku/python-getting-started:latest")
+
+	if diags := resourceAppDeployRead(ctx, d, client); diags.HasError() {
+		t.Fatalf("read failed: %v", diags)
+	}
+
+	if d.Get("image").(string) != "dokku/python-getting-started:latest" {
+		t.Errorf("expected image drift to be detected, got %v", d.Get("image"))
+	}
+}
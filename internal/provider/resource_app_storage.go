@@ -0,0 +1,213 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// Where storage:ensure-directory creates directories on the host
+const dokkuStorageRoot = "/var/lib/dokku/data/storage"
+
+// Mounts are given to dokku as host:container, so neither path can contain a
+// colon
+var validateStoragePath = validation.StringMatch(regexp.MustCompile(`^/[^:\s]*$`), "must be an absolute path without colons or whitespace")
+
+// Mounts a directory on the host into an app's containers.
+//
+// Dokku has no command to delete a storage directory, so unmounting (i.e
+// destroying this resource) always leaves the data on the host.
+func resourceAppStorage() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Mounts a directory on the Dokku host into an application's containers, for data that should persist between deploys. Mounts take effect the next time the app is deployed or restarted. Destroying this resource unmounts the directory, but never deletes it or the data in it.",
+		CreateContext: resourceAppStorageCreate,
+		ReadContext:   resourceAppStorageRead,
+		DeleteContext: resourceAppStorageDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+		Schema: map[string]*schema.Schema{
+			"app": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the Dokku application to mount the directory into.",
+			},
+			"name": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				ExactlyOneOf:     []string{"name", "host_path"},
+				ValidateFunc:     validation.StringDoesNotContainAny("/"),
+				DiffSuppressFunc: suppressImportedStorageDiff,
+				Description:      "The name of a directory to create (if it doesn't exist) in dokku's storage directory, `" + dokkuStorageRoot + "`, and mount. Conflicts with `host_path`.",
+			},
+			"host_path": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ExactlyOneOf: []string{"name", "host_path"},
+				ValidateFunc: validateStoragePath,
+				Description:  "The absolute path of an existing directory on the host to mount. Conflicts with `name`. When `name` is set, this is the path of the directory created for it.",
+			},
+			"container_path": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateStoragePath,
+				Description:  "The absolute path the directory is mounted at in the app's containers.",
+			},
+			"chown": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				RequiredWith:     []string{"name"},
+				ValidateFunc:     validation.StringInSlice([]string{"heroku", "herokuish", "packeto", "paketo", "root", "false"}, false),
+				DiffSuppressFunc: suppressImportedStorageDiff,
+				Description:      "Which user to give ownership of the directory created for `name` to, matching the builder the app uses. One of `herokuish`, `heroku`, `paketo`, `packeto`, `root` or `false` (to leave it owned by root). Defaults to dokku's default, `herokuish`.",
+			},
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceAppStorageImport,
+		},
+	}
+}
+
+// Imported mounts only have their host path, as dokku doesn't know which were
+// created for a name or what they were chowned to. So that importing one that's
+// configured with name (and chown) doesn't replace it, and so unmount and
+// remount it, they're only compared against the host path.
+func suppressImportedStorageDiff(k, old, new string, d *schema.ResourceData) bool {
+	if d.Id() == "" || old != "" {
+		return false
+	}
+
+	oldName, newName := d.GetChange("name")
+	if oldName.(string) != "" || newName.(string) == "" {
+		return false
+	}
+
+	return d.Get("host_path").(string) == path.Join(dokkuStorageRoot, newName.(string))
+}
+
+func appStorageId(app string, hostPath string, containerPath string) string {
+	return fmt.Sprintf("%s:%s:%s", app, hostPath, containerPath)
+}
+
+// The mounts for an app, as host:container, from storage:list
+func readAppStorageMounts(ctx context.Context, appName string, client *DokkuClient) ([]string, error) {
+	res := run(ctx, client, fmt.Sprintf("storage:list %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	mounts := []string{}
+
+	for _, line := range strings.Split(res.stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "=====>") {
+			continue
+		}
+		mounts = append(mounts, line)
+	}
+
+	return mounts, nil
+}
+
+func resourceAppStorageCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	appName := d.Get("app").(string)
+	hostPath := d.Get("host_path").(string)
+	containerPath := d.Get("container_path").(string)
+
+	if name, ok := d.GetOk("name"); ok {
+		flags := ""
+		if chown, ok := d.GetOk("chown"); ok {
+			flags = fmt.Sprintf("--chown %s ", shellescape.Quote(chown.(string)))
+		}
+
+		res := run(ctx, sshClient, fmt.Sprintf("storage:ensure-directory %s%s", flags, shellescape.Quote(name.(string))))
+		if res.err != nil {
+			return dokkuDiag(res.err)
+		}
+
+		hostPath = path.Join(dokkuStorageRoot, name.(string))
+		d.Set("host_path", hostPath)
+	}
+
+	res := run(ctx, sshClient, fmt.Sprintf("storage:mount %s %s", appName, shellescape.Quote(hostPath+":"+containerPath)))
+	if res.err != nil {
+		return dokkuDiag(res.err)
+	}
+
+	d.SetId(appStorageId(appName, hostPath, containerPath))
+
+	return resourceAppStorageRead(ctx, d, m)
+}
+
+func resourceAppStorageRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	var diags diag.Diagnostics
+
+	appName := d.Get("app").(string)
+	mount := fmt.Sprintf("%s:%s", d.Get("host_path").(string), d.Get("container_path").(string))
+
+	mounts, err := readAppStorageMounts(ctx, appName, sshClient)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			d.SetId("")
+			return diags
+		}
+		return dokkuDiag(err)
+	}
+
+	if _, ok := sliceToLookupMap(mounts)[mount]; !ok {
+		d.SetId("")
+	}
+
+	return diags
+}
+
+func resourceAppStorageDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	var diags diag.Diagnostics
+
+	res := run(ctx, sshClient, fmt.Sprintf("storage:unmount %s %s", d.Get("app"), shellescape.Quote(d.Get("host_path").(string)+":"+d.Get("container_path").(string))))
+
+	if res.err != nil && !errors.Is(res.err, ErrNotFound) {
+		return dokkuDiag(res.err)
+	}
+
+	d.SetId("")
+
+	return diags
+}
+
+// Import from an ID of the form app:host_path:container_path
+func resourceAppStorageImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("Unexpected ID %s, expected app:host_path:container_path", d.Id())
+	}
+
+	d.Set("app", parts[0])
+	d.Set("host_path", parts[1])
+	d.Set("container_path", parts[2])
+
+	return []*schema.ResourceData{d}, nil
+}
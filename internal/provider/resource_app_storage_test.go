@@ -0,0 +1,263 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestAccAppStorage(t *testing.T) {
+	appName := fmt.Sprintf("storage-app-%s", acctest.RandString(10))
+	hostPath := fmt.Sprintf("%s/%s", dokkuStorageRoot, appName)
+
+	resource.Test(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDokkuAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+resource "dokku_app" "test" {
+	name = "%s"
+}
+
+resource "dokku_app_storage" "test" {
+	app = dokku_app.test.name
+	name = "%s"
+	chown = "heroku"
+	container_path = "/app/storage"
+}
+`, appName, appName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("dokku_app_storage.test", "host_path", hostPath),
+					testAccAppStorageIsMounted(appName, hostPath+":/app/storage"),
+				),
+			},
+			{
+				ResourceName:            "dokku_app_storage.test",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"name", "chown"},
+			},
+			{
+				Config: fmt.Sprintf(`
+resource "dokku_app" "test" {
+	name = "%s"
+}
+
+resource "dokku_app_storage" "test" {
+	app = dokku_app.test.name
+	host_path = "/tmp"
+	container_path = "/app/tmp"
+}
+`, appName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccAppStorageIsMounted(appName, "/tmp:/app/tmp"),
+					testAccAppStorageIsNotMounted(appName, hostPath+":/app/storage"),
+				),
+			},
+		},
+	})
+}
+
+func testAccAppStorageIsMounted(appName string, mount string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		sshClient := testAccProvider.Meta().(*DokkuClient)
+
+		mounts, err := readAppStorageMounts(context.Background(), appName, sshClient)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := sliceToLookupMap(mounts)[mount]; !ok {
+			return fmt.Errorf("expected %s to be mounted for app %s, got %v", mount, appName, mounts)
+		}
+		return nil
+	}
+}
+
+func testAccAppStorageIsNotMounted(appName string, mount string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		sshClient := testAccProvider.Meta().(*DokkuClient)
+
+		mounts, err := readAppStorageMounts(context.Background(), appName, sshClient)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := sliceToLookupMap(mounts)[mount]; ok {
+			return fmt.Errorf("expected %s to be unmounted for app %s", mount, appName)
+		}
+		return nil
+	}
+}
+
+func TestAppStoragePaths(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	dokku.Exec("apps:create test-app")
+
+	// Paths are quoted, so they reach dokku as they're configured
+	d := schema.TestResourceDataRaw(t, resourceAppStorage().Schema, map[string]interface{}{
+		"app":            "test-app",
+		"host_path":      "/srv/it's;$HOME",
+		"container_path": "/data",
+	})
+
+	if diags := resourceAppStorageCreate(ctx, d, client); diags.HasError() {
+		t.Fatalf("create failed: %v", diags)
+	}
+
+	if d.Id() == "" {
+		t.Fatalf("expected the mount to be read back")
+	}
+
+	mount := "-v /srv/it's;$HOME:/data"
+	if _, ok := sliceToLookupMap(dokku.apps["test-app"].dockerOptions["deploy"])[mount]; !ok {
+		t.Errorf("unexpected mounts %v", dokku.apps["test-app"].dockerOptions["deploy"])
+	}
+
+	if diags := resourceAppStorageDelete(ctx, d, client); diags.HasError() {
+		t.Fatalf("delete failed: %v", diags)
+	}
+
+	if _, ok := sliceToLookupMap(dokku.apps["test-app"].dockerOptions["deploy"])[mount]; ok {
+		t.Errorf("expected the mount to be removed, got %v", dokku.apps["test-app"].dockerOptions["deploy"])
+	}
+
+	for _, attr := range []string{"host_path", "container_path"} {
+		for _, value := range []string{"data", "/data:/other", "/my data", ""} {
+			if _, errs := resourceAppStorage().Schema[attr].ValidateFunc(value, attr); len(errs) == 0 {
+				t.Errorf("expected %s %q to be invalid", attr, value)
+			}
+		}
+		if _, errs := resourceAppStorage().Schema[attr].ValidateFunc("/data", attr); len(errs) != 0 {
+			t.Errorf("expected %s %q to be valid, got %v", attr, "/data", errs)
+		}
+	}
+}
+
+func TestAppStorageLifecycle(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	dokku.Exec("apps:create test-app")
+
+	d := schema.TestResourceDataRaw(t, resourceAppStorage().Schema, map[string]interface{}{
+		"app":            "test-app",
+		"name":           "test-app-data",
+		"chown":          "paketo",
+		"container_path": "/data",
+	})
+
+	if diags := resourceAppStorageCreate(ctx, d, client); diags.HasError() {
+		t.Fatalf("create failed: %v", diags)
+	}
+
+	if d.Id() != "test-app:/var/lib/dokku/data/storage/test-app-data:/data" {
+		t.Errorf("unexpected id %s", d.Id())
+	}
+
+	if dokku.storage["test-app-data"] != "paketo" {
+		t.Errorf("expected directory to be created with chown paketo, got %v", dokku.storage)
+	}
+
+	// Drift, the mount was removed outside of terraform
+	dokku.Exec("storage:unmount test-app /var/lib/dokku/data/storage/test-app-data:/data")
+
+	if diags := resourceAppStorageRead(ctx, d, client); diags.HasError() {
+		t.Fatalf("read failed: %v", diags)
+	}
+
+	if d.Id() != "" {
+		t.Errorf("expected unmounted storage to be removed from state")
+	}
+
+	if _, ok := dokku.storage["test-app-data"]; !ok {
+		t.Errorf("expected storage directory to be kept")
+	}
+}
+
+// Importing a mount then planning with the config it's imported into should
+// change nothing, whichever way the config gives the directory
+func TestAppStorageImportPlansClean(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	dokku.Exec("apps:create test-app")
+	dokku.Exec("storage:ensure-directory --chown heroku data")
+	dokku.Exec("storage:mount test-app " + dokkuStorageRoot + "/data:/data")
+	dokku.Exec("storage:mount test-app /srv/uploads:/uploads")
+
+	cases := []struct {
+		name   string
+		id     string
+		config map[string]interface{}
+	}{
+		{
+			name:   "name",
+			id:     appStorageId("test-app", dokkuStorageRoot+"/data", "/data"),
+			config: map[string]interface{}{"app": "test-app", "name": "data", "container_path": "/data"},
+		},
+		{
+			name:   "name and chown",
+			id:     appStorageId("test-app", dokkuStorageRoot+"/data", "/data"),
+			config: map[string]interface{}{"app": "test-app", "name": "data", "chown": "heroku", "container_path": "/data"},
+		},
+		{
+			name:   "host_path in the storage directory",
+			id:     appStorageId("test-app", dokkuStorageRoot+"/data", "/data"),
+			config: map[string]interface{}{"app": "test-app", "host_path": dokkuStorageRoot + "/data", "container_path": "/data"},
+		},
+		{
+			name:   "host_path elsewhere",
+			id:     appStorageId("test-app", "/srv/uploads", "/uploads"),
+			config: map[string]interface{}{"app": "test-app", "host_path": "/srv/uploads", "container_path": "/uploads"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := resourceAppStorage().Data(nil)
+			d.SetId(c.id)
+
+			imported, err := resourceAppStorageImport(ctx, d, client)
+			if err != nil {
+				t.Fatalf("import failed: %v", err)
+			}
+			if diags := resourceAppStorageRead(ctx, imported[0], client); diags.HasError() {
+				t.Fatalf("read failed: %v", diags)
+			}
+
+			diff, err := resourceAppStorage().Diff(ctx, imported[0].State(), terraform.NewResourceConfigRaw(c.config), client)
+			if err != nil {
+				t.Fatalf("plan failed: %v", err)
+			}
+			if diff != nil && !diff.Empty() {
+				t.Errorf("expected the imported mount to plan clean, got %v", diff.Attributes)
+			}
+		})
+	}
+
+	// A different directory is still a change
+	d := resourceAppStorage().Data(nil)
+	d.SetId(appStorageId("test-app", dokkuStorageRoot+"/data", "/data"))
+	imported, err := resourceAppStorageImport(ctx, d, client)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	diff, err := resourceAppStorage().Diff(ctx, imported[0].State(), terraform.NewResourceConfigRaw(map[string]interface{}{
+		"app": "test-app", "name": "other", "container_path": "/data",
+	}), client)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if diff == nil || !diff.RequiresNew() {
+		t.Errorf("expected a mount of another directory to be replaced, got %v", diff)
+	}
+}
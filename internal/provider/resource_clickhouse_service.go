@@ -3,10 +3,10 @@ package provider
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 // Had issues with other images and cloning (not implemented at time of writing)
@@ -21,6 +21,11 @@ func resourceClickhouseService() *schema.Resource {
 		ReadContext:   resourceChRead,
 		UpdateContext: resourceChUpdate,
 		DeleteContext: resourceChDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -42,23 +47,23 @@ func resourceClickhouseService() *schema.Resource {
 }
 
 func resourceChCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
-	res := run(sshClient, fmt.Sprintf("clickhouse:create %s", d.Get("name").(string)))
+	res := run(ctx, sshClient, fmt.Sprintf("clickhouse:create %s", d.Get("name").(string)))
 
 	if res.err != nil {
-		return diag.FromErr(res.err)
+		return dokkuDiag(res.err)
 	}
 
 	d.SetId(d.Get("name").(string))
 
 	if d.Get("stopped").(bool) {
-		res = run(sshClient, fmt.Sprintf("clickhouse:stop %s", d.Id()))
+		res = run(ctx, sshClient, fmt.Sprintf("clickhouse:stop %s", d.Id()))
 
 		if res.err != nil {
-			return diag.FromErr(res.err)
+			return dokkuDiag(res.err)
 		}
 	}
 
@@ -66,14 +71,14 @@ func resourceChCreate(ctx context.Context, d *schema.ResourceData, m interface{}
 }
 
 func resourceChRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
-	serviceInfo, err := getServiceInfo("clickhouse", d.Id(), sshClient)
+	serviceInfo, err := getServiceInfo(ctx, "clickhouse", d.Id(), sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	if serviceInfo == nil {
@@ -89,7 +94,7 @@ func resourceChRead(ctx context.Context, d *schema.ResourceData, m interface{})
 }
 
 func resourceChUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
@@ -98,13 +103,13 @@ func resourceChUpdate(ctx context.Context, d *schema.ResourceData, m interface{}
 
 		isStopped := d.Get("stopped").(bool)
 		if isStopped {
-			res = run(sshClient, fmt.Sprintf("clickhouse:stop %s", d.Id()))
+			res = run(ctx, sshClient, fmt.Sprintf("clickhouse:stop %s", d.Id()))
 		} else {
-			res = run(sshClient, fmt.Sprintf("clickhouse:start %s", d.Id()))
+			res = run(ctx, sshClient, fmt.Sprintf("clickhouse:start %s", d.Id()))
 		}
 
 		if res.err != nil {
-			return diag.FromErr(res.err)
+			return dokkuDiag(res.err)
 		}
 	}
 
@@ -112,14 +117,14 @@ func resourceChUpdate(ctx context.Context, d *schema.ResourceData, m interface{}
 }
 
 func resourceChDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
-	res := run(sshClient, fmt.Sprintf("clickhouse:destroy %s -f", d.Id()))
+	res := run(ctx, sshClient, fmt.Sprintf("clickhouse:destroy %s -f", d.Id()))
 
 	if res.err != nil {
-		return diag.FromErr(res.err)
+		return dokkuDiag(res.err)
 	}
 
 	d.SetId("")
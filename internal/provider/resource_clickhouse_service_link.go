@@ -2,10 +2,10 @@ package provider
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 func resourceClickhouseServiceLink() *schema.Resource {
@@ -14,6 +14,10 @@ func resourceClickhouseServiceLink() *schema.Resource {
 		CreateContext: resourceClickhouseServiceLinkCreate,
 		ReadContext:   resourceClickhouseServiceLinkRead,
 		DeleteContext: resourceClickhouseServiceLinkDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"service": {
 				Type:     schema.TypeString,
@@ -47,12 +51,12 @@ const clickhouseServiceCmd = "clickhouse"
 
 //
 func resourceClickhouseServiceLinkCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkCreate(d, clickhouseServiceCmd, m.(*goph.Client))
+	err := serviceLinkCreate(ctx, d, clickhouseServiceCmd, m.(*DokkuClient))
 
 	var diags diag.Diagnostics
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
@@ -60,12 +64,12 @@ func resourceClickhouseServiceLinkCreate(ctx context.Context, d *schema.Resource
 
 //
 func resourceClickhouseServiceLinkRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkRead(d, clickhouseServiceCmd, m.(*goph.Client))
+	err := serviceLinkRead(ctx, d, clickhouseServiceCmd, m.(*DokkuClient))
 
 	var diags diag.Diagnostics
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
@@ -73,12 +77,12 @@ func resourceClickhouseServiceLinkRead(ctx context.Context, d *schema.ResourceDa
 
 //
 func resourceClickhouseServiceLinkDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkDelete(d, clickhouseServiceCmd, m.(*goph.Client))
+	err := serviceLinkDelete(ctx, d, clickhouseServiceCmd, m.(*DokkuClient))
 
 	var diags diag.Diagnostics
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
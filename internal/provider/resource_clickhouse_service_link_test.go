@@ -1,13 +1,13 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
-	"github.com/melbahja/goph"
 )
 
 func TestAccClickhouseServiceLink(t *testing.T) {
@@ -89,9 +89,9 @@ resource "dokku_clickhouse_service_link" "test" {
 
 func testAccClickhouseServiceIsLinked(serviceName string, appName string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
-		out := run(sshClient, fmt.Sprintf("clickhouse:linked %s %s", serviceName, appName))
+		out := run(context.Background(), sshClient, fmt.Sprintf("clickhouse:linked %s %s", serviceName, appName))
 
 		if out.err != nil {
 			return fmt.Errorf("service %s not linked to app %s - %v", serviceName, appName, out.err)
@@ -102,9 +102,9 @@ func testAccClickhouseServiceIsLinked(serviceName string, appName string) resour
 
 func testAccClickhouseServiceIsNotLinked(serviceName string, appName string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
-		out := run(sshClient, fmt.Sprintf("clickhouse:linked %s %s", serviceName, appName))
+		out := run(context.Background(), sshClient, fmt.Sprintf("clickhouse:linked %s %s", serviceName, appName))
 
 		if out.err == nil {
 			return fmt.Errorf("service %s still linked to app %s - %v", serviceName, appName, out.err)
@@ -116,17 +116,17 @@ func testAccClickhouseServiceIsNotLinked(serviceName string, appName string) res
 // Shouldn't really need to be explicit about the link being destroyed - if
 // app and service both gone then the link cannot exist
 func testClickhouseServiceLinkDestroy(s *terraform.State) error {
-	sshClient := testAccProvider.Meta().(*goph.Client)
+	sshClient := testAccProvider.Meta().(*DokkuClient)
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type == "dokku_app" {
-			app, _ := dokkuAppRetrieve(rs.Primary.ID, sshClient)
+			app, _ := dokkuAppRetrieve(context.Background(), rs.Primary.ID, sshClient, resourceApp().Data(rs.Primary))
 
 			if app.Id != "" {
 				return fmt.Errorf("Dokku app %s should not exist", rs.Primary.ID)
 			}
 		} else if rs.Type == "dokku_clickhouse_service" {
-			clickhouse, err := getServiceInfo("clickhouse", rs.Primary.ID, sshClient)
+			clickhouse, err := getServiceInfo(context.Background(), "clickhouse", rs.Primary.ID, sshClient)
 
 			if err != nil {
 				return fmt.Errorf("Could not read clickhouse service %s", rs.Primary.ID)
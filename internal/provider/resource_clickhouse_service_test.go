@@ -1,13 +1,13 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
-	"github.com/melbahja/goph"
 )
 
 func TestAccClickhouseService(t *testing.T) {
@@ -88,9 +88,9 @@ func testClickhouseServiceExists(n string) resource.TestCheckFunc {
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
-		service, err := getServiceInfo("clickhouse", rs.Primary.ID, sshClient)
+		service, err := getServiceInfo(context.Background(), "clickhouse", rs.Primary.ID, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading clickhouse resource %s", rs.Primary.ID)
@@ -116,9 +116,9 @@ func testClickhouseServiceIsStopped(n string, isStopped bool) resource.TestCheck
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
-		service, err := getServiceInfo("clickhouse", rs.Primary.ID, sshClient)
+		service, err := getServiceInfo(context.Background(), "clickhouse", rs.Primary.ID, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading clickhouse resource %s", rs.Primary.ID)
@@ -138,14 +138,14 @@ func testClickhouseServiceIsStopped(n string, isStopped bool) resource.TestCheck
 }
 
 func testClickhouseServiceDestroy(s *terraform.State) error {
-	sshClient := testAccProvider.Meta().(*goph.Client)
+	sshClient := testAccProvider.Meta().(*DokkuClient)
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "dokku_clickhouse_service" {
 			continue
 		}
 
-		service, err := getServiceInfo("clickhouse", rs.Primary.ID, sshClient)
+		service, err := getServiceInfo(context.Background(), "clickhouse", rs.Primary.ID, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Dokku clickhouse service %s could not be read: %v", rs.Primary.ID, err)
@@ -0,0 +1,345 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"al.essio.dev/pkg/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// Requires the dokku-letsencrypt plugin
+// https://github.com/dokku/dokku-letsencrypt
+func resourceLetsencrypt() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Issues a Let's Encrypt TLS certificate for all of a Dokku application's domains, using the dokku-letsencrypt plugin. The certificate is re-issued when the app's domains or the settings here change. Requires the letsencrypt Dokku plugin to be installed.",
+		CreateContext: resourceLetsencryptCreate,
+		ReadContext:   resourceLetsencryptRead,
+		UpdateContext: resourceLetsencryptUpdate,
+		DeleteContext: resourceLetsencryptDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
+		Schema: map[string]*schema.Schema{
+			"app": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "The name of the Dokku application to issue a certificate for.",
+			},
+			"email": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The email address to register with the ACME server, which Let's Encrypt uses for expiry notices.",
+			},
+			"server": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "production",
+				ValidateFunc: validation.Any(
+					validation.StringInSlice([]string{"production", "staging"}, false),
+					validation.IsURLWithHTTPS,
+				),
+				Description: "The ACME server to request the certificate from. Either `production`, `staging` (for testing, as certificates from it aren't trusted) or the https URL of an ACME directory.",
+			},
+			"dns_provider": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The lego DNS provider to use for a DNS-01 challenge, e.g `route53`. When not set, the certificate is requested with an HTTP-01 challenge, which requires the app's domains to be publicly reachable.",
+			},
+			"dns_provider_config": {
+				Type: schema.TypeMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional:     true,
+				Sensitive:    true,
+				RequiredWith: []string{"dns_provider"},
+				Description:  "Environment variables for the DNS provider, e.g `AWS_ACCESS_KEY_ID`. See the lego docs for the variables each provider needs. These can't be read back from dokku, so changes made outside of terraform aren't detected.",
+			},
+			"domains": {
+				Type: schema.TypeSet,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional:    true,
+				Computed:    true,
+				Description: "The app's domains. Set this to the `domains` of the `dokku_app` so the certificate is issued after the domains are set, and re-issued when they change. Defaults to the app's domains when the certificate is issued.",
+			},
+			"auto_renew": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Whether to make sure dokku's letsencrypt cron job, which renews certificates before they expire, is in place. The cron job is shared by every app on the host, so it's never removed by this resource - setting this to false (or destroying the resource) leaves it as it is. Use `dokku letsencrypt:cron-job --remove` on the host to turn off renewal for every app.",
+			},
+			"expiry": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "When the certificate expires, as reported by `letsencrypt:list` e.g `2024-07-19 12:12:12`.",
+			},
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+	}
+}
+
+type DokkuLetsencrypt struct {
+	Active      bool
+	AutoRenew   bool
+	Email       string
+	Server      string
+	DnsProvider string
+	Expiry      string
+}
+
+func readLetsencrypt(ctx context.Context, appName string, client *DokkuClient) (*DokkuLetsencrypt, error) {
+	res := run(ctx, client, fmt.Sprintf("letsencrypt:report %s", appName))
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	report := parseKeyValues(strings.Split(res.stdout, "\n")[1:])
+
+	server := report["Letsencrypt server"]
+	if server == "" || server == "default" {
+		server = "production"
+	}
+
+	le := &DokkuLetsencrypt{
+		Active:      report["Letsencrypt active"] == "true",
+		AutoRenew:   report["Letsencrypt autorenew"] == "true",
+		Email:       report["Letsencrypt email"],
+		Server:      server,
+		DnsProvider: report["Letsencrypt dns provider"],
+	}
+
+	expiry, err := readLetsencryptExpiry(ctx, appName, client)
+	if err != nil {
+		return nil, err
+	}
+	le.Expiry = expiry
+
+	return le, nil
+}
+
+// letsencrypt:list has a line per app with a certificate, like
+// app-name           2024-07-19 12:12:12       89d, 23h, 59m, 40s        59d, 23h, 59m, 40s
+func readLetsencryptExpiry(ctx context.Context, appName string, client *DokkuClient) (string, error) {
+	res := run(ctx, client, "letsencrypt:list")
+
+	if res.err != nil {
+		return "", res.err
+	}
+
+	for _, line := range strings.Split(res.stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == appName {
+			return fields[1] + " " + fields[2], nil
+		}
+	}
+
+	return "", nil
+}
+
+// Set (or unset, when the value is empty) an app's letsencrypt property
+func dokkuLetsencryptSet(ctx context.Context, appName string, property string, value string, sensitive bool, client *DokkuClient) error {
+	cmd := fmt.Sprintf("letsencrypt:set %s %s", appName, property)
+	if value != "" {
+		cmd = fmt.Sprintf("%s %s", cmd, shellescape.Quote(value))
+	}
+
+	sensitiveStrings := []string{}
+	if sensitive && value != "" {
+		sensitiveStrings = append(sensitiveStrings, value)
+	}
+
+	return run(ctx, client, cmd, sensitiveStrings...).err
+}
+
+// The cron job renews the certificates of every app on the host, so it's only
+// ever added. Adding it when it's already in place is a no-op.
+func dokkuLetsencryptCronAdd(ctx context.Context, client *DokkuClient) error {
+	return run(ctx, client, "letsencrypt:cron-job --add").err
+}
+
+// Apply the settings which have changed, all of them when creating
+func dokkuLetsencryptSettingsSet(ctx context.Context, d *schema.ResourceData, client *DokkuClient) error {
+	appName := d.Get("app").(string)
+
+	if d.HasChange("email") {
+		if err := dokkuLetsencryptSet(ctx, appName, "email", d.Get("email").(string), false, client); err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("server") {
+		server := d.Get("server").(string)
+		if server == "production" {
+			server = ""
+		}
+		if err := dokkuLetsencryptSet(ctx, appName, "server", server, false, client); err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("dns_provider") {
+		if err := dokkuLetsencryptSet(ctx, appName, "dns-provider", d.Get("dns_provider").(string), false, client); err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("dns_provider_config") {
+		old, new := d.GetChange("dns_provider_config")
+		oldConfig := mapOfInterfacesToMapOfStrings(old.(map[string]interface{}))
+		newConfig := mapOfInterfacesToMapOfStrings(new.(map[string]interface{}))
+
+		for _, key := range calculateMissingKeys(newConfig, oldConfig) {
+			if err := dokkuLetsencryptSet(ctx, appName, "dns-provider-"+key, "", false, client); err != nil {
+				return err
+			}
+		}
+
+		for _, key := range sortedKeys(newConfig) {
+			if oldConfig[key] == newConfig[key] {
+				continue
+			}
+			if err := dokkuLetsencryptSet(ctx, appName, "dns-provider-"+key, newConfig[key], true, client); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func resourceLetsencryptCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	appName := d.Get("app").(string)
+
+	if err := dokkuLetsencryptSettingsSet(ctx, d, sshClient); err != nil {
+		return dokkuDiag(err)
+	}
+
+	res := run(ctx, sshClient, fmt.Sprintf("letsencrypt:enable %s", appName))
+	if res.err != nil {
+		return dokkuDiag(res.err)
+	}
+
+	if d.Get("auto_renew").(bool) {
+		if err := dokkuLetsencryptCronAdd(ctx, sshClient); err != nil {
+			return dokkuDiag(err)
+		}
+	}
+
+	d.SetId(appName)
+
+	return resourceLetsencryptRead(ctx, d, m)
+}
+
+func resourceLetsencryptRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	var diags diag.Diagnostics
+
+	appName := d.Id()
+
+	le, err := readLetsencrypt(ctx, appName, sshClient)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			d.SetId("")
+			return diags
+		}
+		return dokkuDiag(err)
+	}
+
+	if !le.Active {
+		d.SetId("")
+		return diags
+	}
+
+	domains, err := readAppDomains(ctx, appName, sshClient)
+	if err != nil {
+		return dokkuDiag(err)
+	}
+
+	d.Set("app", appName)
+	d.Set("email", le.Email)
+	d.Set("server", le.Server)
+	d.Set("dns_provider", le.DnsProvider)
+	d.Set("domains", domains)
+	// Whether the cron job is in place only matters when this resource is
+	// meant to make sure it is, as it's shared with other apps
+	if d.Get("auto_renew").(bool) {
+		d.Set("auto_renew", le.AutoRenew)
+	}
+	d.Set("expiry", le.Expiry)
+
+	return diags
+}
+
+func resourceLetsencryptUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	appName := d.Get("app").(string)
+
+	if err := dokkuLetsencryptSettingsSet(ctx, d, sshClient); err != nil {
+		return dokkuDiag(err)
+	}
+
+	// Any change other than to the cron job needs a new certificate
+	if d.HasChanges("email", "server", "dns_provider", "dns_provider_config", "domains") {
+		res := run(ctx, sshClient, fmt.Sprintf("letsencrypt:enable %s", appName))
+		if res.err != nil {
+			return dokkuDiag(res.err)
+		}
+	}
+
+	if d.HasChange("auto_renew") && d.Get("auto_renew").(bool) {
+		if err := dokkuLetsencryptCronAdd(ctx, sshClient); err != nil {
+			return dokkuDiag(err)
+		}
+	}
+
+	return resourceLetsencryptRead(ctx, d, m)
+}
+
+func resourceLetsencryptDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	sshClient := m.(*DokkuClient)
+
+	var diags diag.Diagnostics
+
+	appName := d.Get("app").(string)
+
+	res := run(ctx, sshClient, fmt.Sprintf("letsencrypt:disable %s", appName))
+	if res.err != nil {
+		if errors.Is(res.err, ErrNotFound) {
+			return diags
+		}
+		return dokkuDiag(res.err)
+	}
+
+	properties := []string{"email", "server", "dns-provider"}
+	for key := range d.Get("dns_provider_config").(map[string]interface{}) {
+		properties = append(properties, "dns-provider-"+key)
+	}
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		if err := dokkuLetsencryptSet(ctx, appName, property, "", false, sshClient); err != nil {
+			return dokkuDiag(err)
+		}
+	}
+
+	return diags
+}
@@ -0,0 +1,183 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// Against a real dokku host, this needs the letsencrypt plugin installed and
+// for *.dokku.me to resolve to the host, so it only runs there when
+// DOKKU_TEST_LETSENCRYPT is set
+func TestAccLetsencrypt(t *testing.T) {
+	if os.Getenv("DOKKU_SSH_HOST") != "" && os.Getenv("DOKKU_TEST_LETSENCRYPT") == "" {
+		t.Skip("DOKKU_TEST_LETSENCRYPT must be set to test letsencrypt against a real dokku host")
+	}
+
+	appName := fmt.Sprintf("letsencrypt-app-%s", acctest.RandString(10))
+	domain := fmt.Sprintf("%s.dokku.me", appName)
+
+	resource.Test(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccDokkuAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+resource "dokku_app" "test" {
+	name = "%s"
+	domains = ["%s"]
+}
+
+resource "dokku_letsencrypt" "test" {
+	app = dokku_app.test.name
+	email = "test@dokku.me"
+	server = "staging"
+	domains = dokku_app.test.domains
+}
+`, appName, domain),
+				Check: resource.ComposeTestCheckFunc(
+					testAccLetsencryptActive(appName, true),
+					resource.TestCheckResourceAttr("dokku_letsencrypt.test", "server", "staging"),
+					resource.TestCheckResourceAttr("dokku_letsencrypt.test", "auto_renew", "true"),
+					resource.TestCheckResourceAttrSet("dokku_letsencrypt.test", "expiry"),
+				),
+			},
+			{
+				ResourceName:      "dokku_letsencrypt.test",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				Config: fmt.Sprintf(`
+resource "dokku_app" "test" {
+	name = "%s"
+	domains = ["%s"]
+}
+`, appName, domain),
+				Check: resource.ComposeTestCheckFunc(
+					testAccLetsencryptActive(appName, false),
+				),
+			},
+		},
+	})
+}
+
+func testAccLetsencryptActive(appName string, active bool) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		sshClient := testAccProvider.Meta().(*DokkuClient)
+
+		le, err := readLetsencrypt(context.Background(), appName, sshClient)
+		if err != nil {
+			return err
+		}
+
+		if le.Active != active {
+			return fmt.Errorf("expected letsencrypt active for app %s to be %t", appName, active)
+		}
+		return nil
+	}
+}
+
+func TestLetsencryptLifecycle(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	dokku.Exec("apps:create test-app")
+
+	d := schema.TestResourceDataRaw(t, resourceLetsencrypt().Schema, map[string]interface{}{
+		"app":                 "test-app",
+		"email":               "test@dokku.me",
+		"dns_provider":        "route53",
+		"dns_provider_config": map[string]interface{}{"AWS_SECRET_ACCESS_KEY": "secret"},
+	})
+
+	if diags := resourceLetsencryptCreate(ctx, d, client); diags.HasError() {
+		t.Fatalf("create failed: %v", diags)
+	}
+
+	app := dokku.apps["test-app"]
+	if app.letsencrypt["dns-provider-AWS_SECRET_ACCESS_KEY"] != "secret" || app.letsencrypt["server"] != "" {
+		t.Errorf("unexpected letsencrypt properties %v", app.letsencrypt)
+	}
+
+	if d.Get("expiry").(string) != app.letsencryptExpiry || d.Get("server").(string) != "production" {
+		t.Errorf("unexpected expiry %v, server %v", d.Get("expiry"), d.Get("server"))
+	}
+
+	if !dokku.letsencryptCron || !d.Get("auto_renew").(bool) {
+		t.Errorf("expected auto renew to be enabled")
+	}
+
+	if diags := resourceLetsencryptDelete(ctx, d, client); diags.HasError() {
+		t.Fatalf("delete failed: %v", diags)
+	}
+
+	if app.letsencryptExpiry != "" || len(app.letsencrypt) != 0 {
+		t.Errorf("expected letsencrypt to be disabled and unset, got %v", app.letsencrypt)
+	}
+
+	if diags := resourceLetsencryptRead(ctx, d, client); diags.HasError() || d.Id() != "" {
+		t.Errorf("expected disabled letsencrypt to be removed from state, %v", diags)
+	}
+}
+
+func TestLetsencryptAutoRenewShared(t *testing.T) {
+	dokku, client := newFakeDokkuClient(t)
+	ctx := context.Background()
+
+	dokku.Exec("apps:create renewed-app")
+	dokku.Exec("apps:create other-app")
+
+	renewed := schema.TestResourceDataRaw(t, resourceLetsencrypt().Schema, map[string]interface{}{
+		"app":   "renewed-app",
+		"email": "test@dokku.me",
+	})
+	if diags := resourceLetsencryptCreate(ctx, renewed, client); diags.HasError() {
+		t.Fatalf("create failed: %v", diags)
+	}
+
+	// Another app's resource opting out doesn't turn off renewal for the host
+	other := schema.TestResourceDataRaw(t, resourceLetsencrypt().Schema, map[string]interface{}{
+		"app":        "other-app",
+		"email":      "test@dokku.me",
+		"auto_renew": false,
+	})
+	if diags := resourceLetsencryptCreate(ctx, other, client); diags.HasError() {
+		t.Fatalf("create failed: %v", diags)
+	}
+
+	if !dokku.letsencryptCron {
+		t.Errorf("expected the cron job to be left in place")
+	}
+
+	if other.Get("auto_renew").(bool) {
+		t.Errorf("expected auto_renew to stay as configured, rather than reporting the host's cron job")
+	}
+
+	if diags := resourceLetsencryptDelete(ctx, renewed, client); diags.HasError() {
+		t.Fatalf("delete failed: %v", diags)
+	}
+	if !dokku.letsencryptCron {
+		t.Errorf("expected the cron job to be left in place when a resource is destroyed")
+	}
+
+	// The resource that makes sure the cron job is in place notices it's gone
+	dokku.Exec("letsencrypt:cron-job --remove")
+	reread := schema.TestResourceDataRaw(t, resourceLetsencrypt().Schema, map[string]interface{}{
+		"app":   "other-app",
+		"email": "test@dokku.me",
+	})
+	reread.SetId("other-app")
+	if diags := resourceLetsencryptRead(ctx, reread, client); diags.HasError() {
+		t.Fatalf("read failed: %v", diags)
+	}
+	if reread.Get("auto_renew").(bool) {
+		t.Errorf("expected the missing cron job to be read")
+	}
+}
@@ -2,10 +2,10 @@ package provider
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 func resourceMysqlService() *schema.Resource {
@@ -15,6 +15,11 @@ func resourceMysqlService() *schema.Resource {
 		ReadContext:   resourceMysqlRead,
 		UpdateContext: resourceMysqlUpdate,
 		DeleteContext: resourceMysqlDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -53,15 +58,15 @@ func resourceMysqlService() *schema.Resource {
 }
 
 func resourceMysqlCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
 	mysql := NewMysqlServiceFromResourceData(d)
-	err := dokkuMysqlCreate(mysql, sshClient)
+	err := dokkuMysqlCreate(ctx, mysql, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	mysql.setOnResourceData(d)
@@ -70,7 +75,7 @@ func resourceMysqlCreate(ctx context.Context, d *schema.ResourceData, m interfac
 }
 
 func resourceMysqlRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
@@ -82,10 +87,10 @@ func resourceMysqlRead(ctx context.Context, d *schema.ResourceData, m interface{
 	}
 
 	mysql := NewMysqlService(serviceName)
-	err := dokkuMysqlRead(mysql, sshClient)
+	err := dokkuMysqlRead(ctx, mysql, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	mysql.setOnResourceData(d)
@@ -94,15 +99,15 @@ func resourceMysqlRead(ctx context.Context, d *schema.ResourceData, m interface{
 }
 
 func resourceMysqlUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
 	mysql := NewMysqlServiceFromResourceData(d)
-	err := dokkuMysqlUpdate(mysql, d, sshClient)
+	err := dokkuMysqlUpdate(ctx, mysql, d, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	mysql.setOnResourceData(d)
@@ -111,14 +116,14 @@ func resourceMysqlUpdate(ctx context.Context, d *schema.ResourceData, m interfac
 }
 
 func resourceMysqlDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
-	err := dokkuMysqlDestroy(NewMysqlService(d.Id()), sshClient)
+	err := dokkuMysqlDestroy(ctx, NewMysqlService(d.Id()), sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
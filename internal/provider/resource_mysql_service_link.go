@@ -2,10 +2,10 @@ package provider
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 func resourceMysqlServiceLink() *schema.Resource {
@@ -14,6 +14,10 @@ func resourceMysqlServiceLink() *schema.Resource {
 		CreateContext: resourceMysqlServiceLinkCreate,
 		ReadContext:   resourceMysqlServiceLinkRead,
 		DeleteContext: resourceMysqlServiceLinkDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"service": {
 				Type:     schema.TypeString,
@@ -47,12 +51,12 @@ const mysqlServiceCmd = "mysql"
 
 //
 func resourceMysqlServiceLinkCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkCreate(d, mysqlServiceCmd, m.(*goph.Client))
+	err := serviceLinkCreate(ctx, d, mysqlServiceCmd, m.(*DokkuClient))
 
 	var diags diag.Diagnostics
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
@@ -60,12 +64,12 @@ func resourceMysqlServiceLinkCreate(ctx context.Context, d *schema.ResourceData,
 
 //
 func resourceMysqlServiceLinkRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkRead(d, mysqlServiceCmd, m.(*goph.Client))
+	err := serviceLinkRead(ctx, d, mysqlServiceCmd, m.(*DokkuClient))
 
 	var diags diag.Diagnostics
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
@@ -73,12 +77,12 @@ func resourceMysqlServiceLinkRead(ctx context.Context, d *schema.ResourceData, m
 
 //
 func resourceMysqlServiceLinkDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkDelete(d, mysqlServiceCmd, m.(*goph.Client))
+	err := serviceLinkDelete(ctx, d, mysqlServiceCmd, m.(*DokkuClient))
 
 	var diags diag.Diagnostics
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
@@ -1,13 +1,13 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
-	"github.com/melbahja/goph"
 )
 
 func TestAccMysqlServiceLink(t *testing.T) {
@@ -57,9 +57,9 @@ resource "dokku_mysql_service_link" "test" {
 
 func testAccMysqlServiceIsLinked(serviceName string, appName string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
-		out := run(sshClient, fmt.Sprintf("mysql:linked %s %s", serviceName, appName))
+		out := run(context.Background(), sshClient, fmt.Sprintf("mysql:linked %s %s", serviceName, appName))
 
 		if out.err != nil {
 			return fmt.Errorf("service %s not linked to app %s - %v", serviceName, appName, out.err)
@@ -70,9 +70,9 @@ func testAccMysqlServiceIsLinked(serviceName string, appName string) resource.Te
 
 func testAccMysqlServiceIsNotLinked(serviceName string, appName string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
-		out := run(sshClient, fmt.Sprintf("mysql:linked %s %s", serviceName, appName))
+		out := run(context.Background(), sshClient, fmt.Sprintf("mysql:linked %s %s", serviceName, appName))
 
 		if out.err == nil {
 			return fmt.Errorf("service %s still linked to app %s - %v", serviceName, appName, out.err)
@@ -84,18 +84,18 @@ func testAccMysqlServiceIsNotLinked(serviceName string, appName string) resource
 // Shouldn't really need to be explicit about the link being destroyed - if
 // app and service both gone then the link cannot exist
 func testMysqlServiceLinkDestroy(s *terraform.State) error {
-	sshClient := testAccProvider.Meta().(*goph.Client)
+	sshClient := testAccProvider.Meta().(*DokkuClient)
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type == "dokku_app" {
-			app, _ := dokkuAppRetrieve(rs.Primary.ID, sshClient)
+			app, _ := dokkuAppRetrieve(context.Background(), rs.Primary.ID, sshClient, resourceApp().Data(rs.Primary))
 
 			if app.Id != "" {
 				return fmt.Errorf("Dokku app %s should not exist", rs.Primary.ID)
 			}
 		} else if rs.Type == "dokku_mysql_service" {
 			mysql := NewMysqlService(rs.Primary.ID)
-			err := dokkuMysqlRead(mysql, sshClient)
+			err := dokkuMysqlRead(context.Background(), mysql, sshClient)
 
 			if err != nil {
 				return fmt.Errorf("Could not read MySQL service %s", rs.Primary.ID)
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"slices"
 	"testing"
@@ -8,7 +9,6 @@ import (
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
-	"github.com/melbahja/goph"
 )
 
 func TestAccMysqlService(t *testing.T) {
@@ -142,10 +142,10 @@ func testMysqlServiceExists(n string) resource.TestCheckFunc {
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewMysqlService(rs.Primary.ID)
-		err := dokkuMysqlRead(service, sshClient)
+		err := dokkuMysqlRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading mysql resource %s", rs.Primary.ID)
@@ -171,10 +171,10 @@ func testMysqlServiceName(n string, name string) resource.TestCheckFunc {
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewMysqlService(rs.Primary.ID)
-		err := dokkuMysqlRead(service, sshClient)
+		err := dokkuMysqlRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading mysql resource %s", rs.Primary.ID)
@@ -204,10 +204,10 @@ func testMysqlImageVersion(n string, version string) resource.TestCheckFunc {
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewMysqlService(rs.Primary.ID)
-		err := dokkuMysqlRead(service, sshClient)
+		err := dokkuMysqlRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading mysql resource %s", rs.Primary.ID)
@@ -233,10 +233,10 @@ func testMysqlExposed(n string, isExposed bool, host string) resource.TestCheckF
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewMysqlService(rs.Primary.ID)
-		err := dokkuMysqlRead(service, sshClient)
+		err := dokkuMysqlRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading mysql resource %s", rs.Primary.ID)
@@ -257,7 +257,7 @@ func testMysqlExposed(n string, isExposed bool, host string) resource.TestCheckF
 }
 
 func testMysqlServiceDestroy(s *terraform.State) error {
-	sshClient := testAccProvider.Meta().(*goph.Client)
+	sshClient := testAccProvider.Meta().(*DokkuClient)
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "dokku_mysql_service" {
@@ -265,7 +265,7 @@ func testMysqlServiceDestroy(s *terraform.State) error {
 		}
 
 		service := NewMysqlService(rs.Primary.ID)
-		err := dokkuMysqlRead(service, sshClient)
+		err := dokkuMysqlRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Dokku mysql service %s could not be read: %v", rs.Primary.ID, err)
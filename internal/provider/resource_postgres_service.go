@@ -2,10 +2,10 @@ package provider
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 func resourcePostgresService() *schema.Resource {
@@ -15,6 +15,11 @@ func resourcePostgresService() *schema.Resource {
 		ReadContext:   resourcePgRead,
 		UpdateContext: resourcePgUpdate,
 		DeleteContext: resourcePgDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -73,15 +78,15 @@ func resourcePostgresService() *schema.Resource {
 }
 
 func resourcePgCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
 	pg := NewDokkuPostgresServiceFromResourceData(d)
-	err := dokkuPgCreate(pg, sshClient)
+	err := dokkuPgCreate(ctx, pg, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	pg.setOnResourceData(d)
@@ -92,7 +97,7 @@ func resourcePgCreate(ctx context.Context, d *schema.ResourceData, m interface{}
 }
 
 func resourcePgRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
@@ -104,10 +109,10 @@ func resourcePgRead(ctx context.Context, d *schema.ResourceData, m interface{})
 	}
 
 	pg := NewDokkuPostgresService(serviceName)
-	err := dokkuPgRead(pg, sshClient)
+	err := dokkuPgRead(ctx, pg, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	pg.setOnResourceData(d)
@@ -116,15 +121,15 @@ func resourcePgRead(ctx context.Context, d *schema.ResourceData, m interface{})
 }
 
 func resourcePgUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
 	pg := NewDokkuPostgresServiceFromResourceData(d)
-	err := dokkuPgUpdate(pg, d, sshClient)
+	err := dokkuPgUpdate(ctx, pg, d, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	pg.setOnResourceData(d)
@@ -133,14 +138,14 @@ func resourcePgUpdate(ctx context.Context, d *schema.ResourceData, m interface{}
 }
 
 func resourcePgDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
-	err := dokkuPgDestroy(NewDokkuPostgresService(d.Id()), sshClient)
+	err := dokkuPgDestroy(ctx, NewDokkuPostgresService(d.Id()), sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
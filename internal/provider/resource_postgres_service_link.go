@@ -2,10 +2,10 @@ package provider
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 func resourcePostgresServiceLink() *schema.Resource {
@@ -14,6 +14,10 @@ func resourcePostgresServiceLink() *schema.Resource {
 		CreateContext: resourcePostgresServiceLinkCreate,
 		ReadContext:   resourcePostgresServiceLinkRead,
 		DeleteContext: resourcePostgresServiceLinkDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"service": {
 				Type:     schema.TypeString,
@@ -47,12 +51,12 @@ const pgServiceCmd = "postgres"
 
 //
 func resourcePostgresServiceLinkCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkCreate(d, pgServiceCmd, m.(*goph.Client))
+	err := serviceLinkCreate(ctx, d, pgServiceCmd, m.(*DokkuClient))
 
 	var diags diag.Diagnostics
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
@@ -60,12 +64,12 @@ func resourcePostgresServiceLinkCreate(ctx context.Context, d *schema.ResourceDa
 
 //
 func resourcePostgresServiceLinkRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkRead(d, pgServiceCmd, m.(*goph.Client))
+	err := serviceLinkRead(ctx, d, pgServiceCmd, m.(*DokkuClient))
 
 	var diags diag.Diagnostics
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
@@ -73,12 +77,12 @@ func resourcePostgresServiceLinkRead(ctx context.Context, d *schema.ResourceData
 
 //
 func resourcePostgresServiceLinkDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkDelete(d, pgServiceCmd, m.(*goph.Client))
+	err := serviceLinkDelete(ctx, d, pgServiceCmd, m.(*DokkuClient))
 
 	var diags diag.Diagnostics
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
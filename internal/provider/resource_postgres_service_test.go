@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"slices"
 	"testing"
@@ -8,7 +9,6 @@ import (
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
-	"github.com/melbahja/goph"
 )
 
 func TestAccPostgresService(t *testing.T) {
@@ -230,10 +230,10 @@ func testAccCheckPgServiceExists(n string) resource.TestCheckFunc {
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewDokkuPostgresService(rs.Primary.ID)
-		err := dokkuPgRead(service, sshClient)
+		err := dokkuPgRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading pg resource %s", rs.Primary.ID)
@@ -259,10 +259,10 @@ func testAccCheckPgServiceName(n string, name string) resource.TestCheckFunc {
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewDokkuPostgresService(rs.Primary.ID)
-		err := dokkuPgRead(service, sshClient)
+		err := dokkuPgRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading pg resource %s", rs.Primary.ID)
@@ -292,10 +292,10 @@ func testAccCheckPgServiceImageAndVersion(n string, image string, version string
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewDokkuPostgresService(rs.Primary.ID)
-		err := dokkuPgRead(service, sshClient)
+		err := dokkuPgRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading pg resource %s", rs.Primary.ID)
@@ -325,10 +325,10 @@ func testAccCheckPgServiceStopped(n string, isStopped bool) resource.TestCheckFu
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewDokkuPostgresService(rs.Primary.ID)
-		err := dokkuPgRead(service, sshClient)
+		err := dokkuPgRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading pg resource %s", rs.Primary.ID)
@@ -358,10 +358,10 @@ func testAccCheckPgExposed(n string, isExposed bool, host string) resource.TestC
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewDokkuPostgresService(rs.Primary.ID)
-		err := dokkuPgRead(service, sshClient)
+		err := dokkuPgRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading pg resource %s", rs.Primary.ID)
@@ -382,7 +382,7 @@ func testAccCheckPgExposed(n string, isExposed bool, host string) resource.TestC
 }
 
 func testPgServiceDestroy(s *terraform.State) error {
-	sshClient := testAccProvider.Meta().(*goph.Client)
+	sshClient := testAccProvider.Meta().(*DokkuClient)
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "dokku_postgres_service" {
@@ -390,7 +390,7 @@ func testPgServiceDestroy(s *terraform.State) error {
 		}
 
 		service := NewDokkuPostgresService(rs.Primary.ID)
-		err := dokkuPgRead(service, sshClient)
+		err := dokkuPgRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Dokku postgres service %s could not be read: %v", rs.Primary.ID, err)
@@ -2,10 +2,10 @@ package provider
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 func resourceRedisService() *schema.Resource {
@@ -15,6 +15,11 @@ func resourceRedisService() *schema.Resource {
 		ReadContext:   resourceRedisRead,
 		UpdateContext: resourceRedisUpdate,
 		DeleteContext: resourceRedisDestroy,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(20 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -53,15 +58,15 @@ func resourceRedisService() *schema.Resource {
 }
 
 func resourceRedisCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
 	redis := NewDokkuRedisServiceFromResourceData(d)
-	err := dokkuRedisCreate(redis, sshClient)
+	err := dokkuRedisCreate(ctx, redis, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	redis.setOnResourceData(d)
@@ -70,7 +75,7 @@ func resourceRedisCreate(ctx context.Context, d *schema.ResourceData, m interfac
 }
 
 func resourceRedisRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
@@ -82,10 +87,10 @@ func resourceRedisRead(ctx context.Context, d *schema.ResourceData, m interface{
 	}
 
 	redis := NewDokkuRedisService(serviceName)
-	err := dokkuRedisRead(redis, sshClient)
+	err := dokkuRedisRead(ctx, redis, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	redis.setOnResourceData(d)
@@ -94,29 +99,29 @@ func resourceRedisRead(ctx context.Context, d *schema.ResourceData, m interface{
 }
 
 func resourceRedisUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
 	redis := NewDokkuRedisServiceFromResourceData(d)
-	err := dokkuRedisUpdate(redis, d, sshClient)
+	err := dokkuRedisUpdate(ctx, redis, d, sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
 }
 
 func resourceRedisDestroy(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	sshClient := m.(*goph.Client)
+	sshClient := m.(*DokkuClient)
 
 	var diags diag.Diagnostics
 
-	err := dokkuRedisDestroy(NewDokkuRedisService(d.Id()), sshClient)
+	err := dokkuRedisDestroy(ctx, NewDokkuRedisService(d.Id()), sshClient)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return diags
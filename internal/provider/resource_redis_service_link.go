@@ -2,10 +2,10 @@ package provider
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/melbahja/goph"
 )
 
 func resourceRedisServiceLink() *schema.Resource {
@@ -14,6 +14,10 @@ func resourceRedisServiceLink() *schema.Resource {
 		CreateContext: resourceRedisServiceLinkCreate,
 		ReadContext:   resourceRedisServiceLinkRead,
 		DeleteContext: resourceRedisServiceLinkDelete,
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
+		},
 		Schema: map[string]*schema.Schema{
 			"service": {
 				Type:     schema.TypeString,
@@ -47,10 +51,10 @@ const redisServiceCmd = "redis"
 
 //
 func resourceRedisServiceLinkCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkCreate(d, redisServiceCmd, m.(*goph.Client))
+	err := serviceLinkCreate(ctx, d, redisServiceCmd, m.(*DokkuClient))
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return nil
@@ -58,10 +62,10 @@ func resourceRedisServiceLinkCreate(ctx context.Context, d *schema.ResourceData,
 
 //
 func resourceRedisServiceLinkRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkRead(d, redisServiceCmd, m.(*goph.Client))
+	err := serviceLinkRead(ctx, d, redisServiceCmd, m.(*DokkuClient))
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return nil
@@ -69,10 +73,10 @@ func resourceRedisServiceLinkRead(ctx context.Context, d *schema.ResourceData, m
 
 //
 func resourceRedisServiceLinkDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	err := serviceLinkDelete(d, redisServiceCmd, m.(*goph.Client))
+	err := serviceLinkDelete(ctx, d, redisServiceCmd, m.(*DokkuClient))
 
 	if err != nil {
-		return diag.FromErr(err)
+		return dokkuDiag(err)
 	}
 
 	return nil
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"slices"
 	"testing"
@@ -8,7 +9,6 @@ import (
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
-	"github.com/melbahja/goph"
 )
 
 func TestAccRedisService(t *testing.T) {
@@ -112,10 +112,10 @@ func testAccCheckRedisServiceExists(n string) resource.TestCheckFunc {
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewDokkuRedisService(rs.Primary.ID)
-		err := dokkuRedisRead(service, sshClient)
+		err := dokkuRedisRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading redis resource %s", rs.Primary.ID)
@@ -141,10 +141,10 @@ func testAccCheckRedisImageAndVersion(n string, image string, version string) re
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewDokkuRedisService(rs.Primary.ID)
-		err := dokkuRedisRead(service, sshClient)
+		err := dokkuRedisRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading redis resource %s", rs.Primary.ID)
@@ -174,10 +174,10 @@ func testAccCheckRedisExposed(n string, isExposed bool, host string) resource.Te
 			return fmt.Errorf("Service ID not present")
 		}
 
-		sshClient := testAccProvider.Meta().(*goph.Client)
+		sshClient := testAccProvider.Meta().(*DokkuClient)
 
 		service := NewDokkuRedisService(rs.Primary.ID)
-		err := dokkuRedisRead(service, sshClient)
+		err := dokkuRedisRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Error reading redis resource %s", rs.Primary.ID)
@@ -198,7 +198,7 @@ func testAccCheckRedisExposed(n string, isExposed bool, host string) resource.Te
 }
 
 func testRedisServiceDestroy(s *terraform.State) error {
-	sshClient := testAccProvider.Meta().(*goph.Client)
+	sshClient := testAccProvider.Meta().(*DokkuClient)
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "dokku_redis_service" {
@@ -206,7 +206,7 @@ func testRedisServiceDestroy(s *terraform.State) error {
 		}
 
 		service := NewDokkuRedisService(rs.Primary.ID)
-		err := dokkuRedisRead(service, sshClient)
+		err := dokkuRedisRead(context.Background(), service, sshClient)
 
 		if err != nil {
 			return fmt.Errorf("Dokku redis service %s could not be read: %v", rs.Primary.ID, err)
@@ -1,60 +1,117 @@
 package provider
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
 )
 
 type SshOutput struct {
 	stdout string
+	stderr string
 	// status code will be 0 if there is no error, otherwise
 	// the status code extracted form the error
 	status int
-	err    error
+	// a *DokkuError when the command fails, check the kind of failure with
+	// errors.Is (e.g errors.Is(res.err, ErrNotFound))
+	err error
 }
 
-// Run a command using the provided SSH client
+// Run a command using the provided client. The command is aborted if the
+// context is cancelled before it completes.
 //
 // strings to be removed from logging can also be provided via `sensitiveStrings`
-func run(client *goph.Client, cmd string, sensitiveStrings ...string) SshOutput {
+func run(ctx context.Context, client Executor, cmd string, sensitiveStrings ...string) SshOutput {
+	return runWithStdin(ctx, client, cmd, nil, sensitiveStrings...)
+}
 
-	cmdSafe := cmd
-	for _, toReplace := range sensitiveStrings {
-		cmdSafe = strings.Replace(cmdSafe, toReplace, "*******", -1)
-	}
+// As run, streaming stdin to the command
+func runWithStdin(ctx context.Context, client Executor, cmd string, stdin io.Reader, sensitiveStrings ...string) SshOutput {
+
+	cmdSafe := redact(cmd, sensitiveStrings)
 
 	log.Printf("[DEBUG] SSH: %s", cmdSafe)
 
-	stdoutRaw, err := client.Run(cmd)
+	stdoutRaw, stderrRaw, err := client.Run(ctx, cmd, stdin)
 
-	stdout := string(stdoutRaw)
-	for _, toReplace := range sensitiveStrings {
-		stdout = strings.Replace(stdout, toReplace, "*******", -1)
+	stdout := redact(string(stdoutRaw), sensitiveStrings)
+	stderr := redact(string(stderrRaw), sensitiveStrings)
+
+	if err != nil && ctx.Err() != nil {
+		log.Printf("[DEBUG] SSH: %s interrupted: %v", cmdSafe, ctx.Err())
+		return SshOutput{
+			stdout: stdout,
+			stderr: stderr,
+			status: 0,
+			err:    fmt.Errorf("Command interrupted (%s): %w", cmdSafe, ctx.Err()),
+		}
 	}
 
 	if err != nil {
-		status := parseStatusCode(err.Error())
-		log.Printf("[DEBUG] SSH: error status %d from %s", status, cmdSafe)
+		dokkuErr := &DokkuError{
+			Cmd:    cmdSafe,
+			Stdout: stdout,
+			Stderr: stderr,
+			Err:    err,
+		}
+
+		status, ok := exitStatus(err)
+		if ok {
+			dokkuErr.Status = status
+			dokkuErr.Kind = classifyDokkuError(status, stdout, stderr)
+		} else {
+			dokkuErr.Kind = ErrTransport
+		}
+
+		log.Printf("[DEBUG] SSH: error status %d from %s: %s", status, cmdSafe, strings.TrimSpace(stderr))
 		return SshOutput{
 			stdout: stdout,
+			stderr: stderr,
 			status: status,
-			err:    errors.New(fmt.Sprintf("Error [%d]: %s", status, stdout)),
+			err:    dokkuErr,
 		}
 	} else {
 		return SshOutput{
 			stdout: stdout,
+			stderr: stderr,
 			status: 0,
 			err:    nil,
 		}
 	}
 }
 
+func redact(str string, sensitiveStrings []string) string {
+	for _, toReplace := range sensitiveStrings {
+		str = strings.Replace(str, toReplace, "*******", -1)
+	}
+	return str
+}
+
+// Extract the exit status of a failed command, from either transport. Returns
+// false if the command didn't get as far as exiting, e.g the connection failed.
+func exitStatus(err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+
+	var sshExitErr *ssh.ExitError
+	if errors.As(err, &sshExitErr) {
+		return sshExitErr.ExitStatus(), true
+	}
+
+	status := parseStatusCode(err.Error())
+	return status, status > 0
+}
+
 // TODO add some debug logging
 func parseStatusCode(str string) int {
 	re := regexp.MustCompile("^Process exited with status ([0-9]+)$")
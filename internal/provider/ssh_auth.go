@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Build the SSH auth from whichever of a private key, user certificate & the
+// ssh-agent have been configured.
+//
+// All of these end up as publickey auth, which the ssh package will only ever
+// attempt once - so rather than a method per source, the signers are combined
+// into a single method and offered to the server in turn.
+//
+// When the ssh-agent is used, the connection to it is returned too. It's used
+// whenever the server asks for keys, so it must be kept open for as long as the
+// auth is, and closed after.
+func sshAuth(sshCert string, sshPassphrase string, userCertificate string, useAgent bool) (_ goph.Auth, _ io.Closer, err error) {
+	var signers []ssh.Signer
+	var agentClient agent.ExtendedAgent
+	var agentConn net.Conn
+
+	if useAgent {
+		agentConn, err = sshAgentConn()
+		if err != nil {
+			return nil, nil, err
+		}
+		agentClient = agent.NewClient(agentConn)
+
+		defer func() {
+			if err != nil {
+				agentConn.Close()
+			}
+		}()
+	}
+
+	if sshCert != "" {
+		signer, err := sshSigner(sshCert, sshPassphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	if userCertificate != "" {
+		cert, err := parseUserCertificate(userCertificate)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		certSigner, err := sshCertSigner(cert, signers, agentClient)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// The certificate is offered ahead of the bare key
+		signers = append([]ssh.Signer{certSigner}, signers...)
+	}
+
+	if len(signers) == 0 && agentClient == nil {
+		return nil, nil, fmt.Errorf("Either ssh_cert or ssh_agent must be set to authenticate with the Dokku host")
+	}
+
+	if agentConn == nil {
+		return sshAuthMethods(signers, nil), nil, nil
+	}
+	return sshAuthMethods(signers, agentClient), agentConn, nil
+}
+
+// Offer the signers, followed by any keys in the ssh-agent
+func sshAuthMethods(signers []ssh.Signer, agentClient agent.ExtendedAgent) goph.Auth {
+	return goph.Auth{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			if agentClient == nil {
+				return signers, nil
+			}
+
+			agentSigners, err := agentClient.Signers()
+			if err != nil {
+				log.Printf("[WARN] could not load keys from ssh-agent: %v", err)
+				return signers, nil
+			}
+
+			return append(signers, agentSigners...), nil
+		}),
+	}
+}
+
+// Load a private key, which can either be a path to the key on disk or the
+// source of the key itself
+func sshSigner(sshCert string, sshPassphrase string) (ssh.Signer, error) {
+	signer, err := goph.GetSignerForRawKey([]byte(sshCert), sshPassphrase)
+
+	if err == nil {
+		log.Printf("[DEBUG] SSH cert looks like its being provided inline\n")
+		return signer, nil
+	}
+
+	log.Printf("[DEBUG] attempting to load SSH cert from file path %s\n", sshCert)
+	log.Printf("[DEBUG] %v\n", err)
+
+	// could not parse a key directly, try it as a filepath
+	signer, err = goph.GetSigner(sshCert, sshPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("Attempted to load private key from file but failed")
+	}
+
+	return signer, nil
+}
+
+// Connect to the ssh-agent listening on SSH_AUTH_SOCK
+func sshAgentConn() (net.Conn, error) {
+	if !goph.HasAgent() {
+		return nil, fmt.Errorf("ssh_agent is set but SSH_AUTH_SOCK is not, is the ssh-agent running?")
+	}
+
+	conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to ssh-agent: %v", err)
+	}
+
+	return conn, nil
+}
+
+// Parse an OpenSSH user certificate, which like the private key can either be
+// given as a path to the certificate on disk or its contents
+func parseUserCertificate(userCertificate string) (*ssh.Certificate, error) {
+	certBytes := []byte(userCertificate)
+
+	if !strings.Contains(userCertificate, "-cert-v01@openssh.com") {
+		log.Printf("[DEBUG] attempting to load SSH user certificate from file path %s\n", userCertificate)
+
+		var err error
+		certBytes, err = os.ReadFile(userCertificate)
+		if err != nil {
+			return nil, fmt.Errorf("Attempted to load SSH user certificate from file but failed: %v", err)
+		}
+	}
+
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse SSH user certificate: %v", err)
+	}
+
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok || cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("ssh_user_certificate is not an OpenSSH user certificate")
+	}
+
+	return cert, nil
+}
+
+// Pair the certificate with its private key - either the configured key or one
+// held by the ssh-agent
+func sshCertSigner(cert *ssh.Certificate, signers []ssh.Signer, agentClient agent.ExtendedAgent) (ssh.Signer, error) {
+	certKey := cert.Key.Marshal()
+
+	if agentClient != nil {
+		agentSigners, err := agentClient.Signers()
+		if err != nil {
+			return nil, fmt.Errorf("Could not load keys from ssh-agent: %v", err)
+		}
+		signers = append(signers, agentSigners...)
+	}
+
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), certKey) {
+			return ssh.NewCertSigner(cert, signer)
+		}
+	}
+
+	return nil, fmt.Errorf("ssh_user_certificate does not match ssh_cert or any key in the ssh-agent")
+}
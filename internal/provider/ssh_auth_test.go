@@ -0,0 +1,319 @@
+package provider
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// A new ed25519 key, and its PEM encoded private key
+func testUserKey(t *testing.T) (ssh.Signer, string) {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, string(pem.EncodeToMemory(block))
+}
+
+// A certificate for the key signed by the CA, in authorized_keys format
+func testCertificate(t *testing.T, ca ssh.Signer, key ssh.PublicKey, certType uint32) string {
+	t.Helper()
+
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        certType,
+		KeyId:           "terraform",
+		ValidPrincipals: []string{"dokku"},
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return string(ssh.MarshalAuthorizedKey(cert))
+}
+
+// Serve the keyring as an ssh-agent on a socket set as SSH_AUTH_SOCK. The
+// returned channel is closed once the provider's connection to it is closed.
+func testAgent(t *testing.T, keyring agent.Agent) <-chan struct{} {
+	t.Helper()
+
+	// Unix socket paths are limited to ~100 characters, which t.TempDir() can
+	// exceed
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	sock := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	closed := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		agent.ServeAgent(keyring, conn)
+		close(closed)
+	}()
+
+	return closed
+}
+
+// Authenticate with a server that accepts the given user key, or certificates
+// signed by the CA
+func testAuthenticate(t *testing.T, auth goph.Auth, userKey ssh.PublicKey, ca ssh.PublicKey) error {
+	t.Helper()
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return ca != nil && string(auth.Marshal()) == string(ca.Marshal())
+		},
+		UserKeyFallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if userKey != nil && string(key.Marshal()) == string(userKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+
+	hostKey, _ := testUserKey(t)
+	config := &ssh.ServerConfig{PublicKeyCallback: checker.Authenticate}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		serverConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer serverConn.Close()
+
+		conn, _, _, err := ssh.NewServerConn(serverConn, config)
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+
+	conn, _, _, err := ssh.NewClientConn(clientConn, listener.Addr().String(), &ssh.ClientConfig{
+		User:            "dokku",
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		conn.Close()
+	}
+	return err
+}
+
+func TestSshAuthKey(t *testing.T) {
+	signer, key := testUserKey(t)
+	other, _ := testUserKey(t)
+
+	auth, agentConn, err := sshAuth(key, "", "", false)
+	if err != nil {
+		t.Fatalf("could not build auth: %v", err)
+	}
+	if agentConn != nil {
+		t.Errorf("expected no ssh-agent connection when the agent isn't used")
+	}
+
+	if err := testAuthenticate(t, auth, signer.PublicKey(), nil); err != nil {
+		t.Errorf("expected the key to be accepted, got %v", err)
+	}
+	if err := testAuthenticate(t, auth, other.PublicKey(), nil); err == nil {
+		t.Errorf("expected authentication to fail for a server that doesn't know the key")
+	}
+}
+
+func TestSshAuthNothingConfigured(t *testing.T) {
+	if _, _, err := sshAuth("", "", "", false); err == nil || !strings.Contains(err.Error(), "Either ssh_cert or ssh_agent must be set") {
+		t.Errorf("expected an error when neither a key nor the agent is configured, got %v", err)
+	}
+}
+
+func TestSshAuthUserCertificate(t *testing.T) {
+	ca, _ := testUserKey(t)
+	signer, key := testUserKey(t)
+	other, _ := testUserKey(t)
+
+	cert := testCertificate(t, ca, signer.PublicKey(), ssh.UserCert)
+
+	auth, _, err := sshAuth(key, "", cert, false)
+	if err != nil {
+		t.Fatalf("could not build auth: %v", err)
+	}
+
+	// The server only trusts the CA, not the key itself
+	if err := testAuthenticate(t, auth, nil, ca.PublicKey()); err != nil {
+		t.Errorf("expected the certificate to be accepted, got %v", err)
+	}
+
+	// The certificate can also be loaded from a file
+	path := filepath.Join(t.TempDir(), "id_ed25519-cert.pub")
+	if err := os.WriteFile(path, []byte(cert), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auth, _, err = sshAuth(key, "", path, false)
+	if err != nil {
+		t.Fatalf("could not build auth from a certificate file: %v", err)
+	}
+	if err := testAuthenticate(t, auth, nil, ca.PublicKey()); err != nil {
+		t.Errorf("expected the certificate from the file to be accepted, got %v", err)
+	}
+
+	cases := []struct {
+		name string
+		cert string
+		err  string
+	}{
+		{"another key", testCertificate(t, ca, other.PublicKey(), ssh.UserCert), "does not match ssh_cert"},
+		{"host certificate", testCertificate(t, ca, signer.PublicKey(), ssh.HostCert), "not an OpenSSH user certificate"},
+		{"missing file", filepath.Join(t.TempDir(), "missing-cert.pub"), "from file but failed"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := sshAuth(key, "", c.cert, false)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected an error containing %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestSshAuthAgent(t *testing.T) {
+	signer, key := testUserKey(t)
+	_, rawKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentSigner, err := ssh.NewSignerFromKey(rawKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: rawKey}); err != nil {
+		t.Fatal(err)
+	}
+	closed := testAgent(t, keyring)
+
+	// The configured key is offered along with the agent's
+	auth, agentConn, err := sshAuth(key, "", "", true)
+	if err != nil {
+		t.Fatalf("could not build auth: %v", err)
+	}
+	if agentConn == nil {
+		t.Fatal("expected the ssh-agent connection to be returned")
+	}
+
+	if err := testAuthenticate(t, auth, agentSigner.PublicKey(), nil); err != nil {
+		t.Errorf("expected the agent's key to be accepted, got %v", err)
+	}
+	if err := testAuthenticate(t, auth, signer.PublicKey(), nil); err != nil {
+		t.Errorf("expected the configured key to be accepted, got %v", err)
+	}
+
+	if err := agentConn.Close(); err != nil {
+		t.Fatalf("could not close the ssh-agent connection: %v", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected the ssh-agent connection to be closed")
+	}
+}
+
+func TestSshAuthAgentUserCertificate(t *testing.T) {
+	ca, _ := testUserKey(t)
+	_, rawKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentSigner, err := ssh.NewSignerFromKey(rawKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: rawKey}); err != nil {
+		t.Fatal(err)
+	}
+	testAgent(t, keyring)
+
+	// The certificate's key is only held by the agent
+	auth, agentConn, err := sshAuth("", "", testCertificate(t, ca, agentSigner.PublicKey(), ssh.UserCert), true)
+	if err != nil {
+		t.Fatalf("could not build auth: %v", err)
+	}
+	defer agentConn.Close()
+
+	if err := testAuthenticate(t, auth, nil, ca.PublicKey()); err != nil {
+		t.Errorf("expected the certificate to be accepted, got %v", err)
+	}
+}
+
+func TestSshAuthAgentClosedOnError(t *testing.T) {
+	closed := testAgent(t, agent.NewKeyring())
+
+	// The agent has no key for the certificate
+	ca, _ := testUserKey(t)
+	signer, _ := testUserKey(t)
+	if _, _, err := sshAuth("", "", testCertificate(t, ca, signer.PublicKey(), ssh.UserCert), true); err == nil {
+		t.Fatal("expected an error for a certificate without its key")
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected the ssh-agent connection to be closed when the auth can't be built")
+	}
+}
+
+func TestSshAuthAgentNotRunning(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	if _, _, err := sshAuth("", "", "", true); err == nil || !strings.Contains(err.Error(), "SSH_AUTH_SOCK is not") {
+		t.Errorf("expected an error when the agent isn't running, got %v", err)
+	}
+}
@@ -0,0 +1,391 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+// SshConnection manages the SSH connection to the dokku host that every
+// resource runs its commands over.
+//
+// A single connection is shared between all resources, with each command
+// running in its own SSH session. SSH sessions can't be reused between
+// commands, so the "pool" here is a bound on the number of sessions that are
+// open at once - sshd will refuse sessions beyond its MaxSessions setting
+// (10 by default), which terraform's default parallelism can easily hit.
+//
+// If the connection drops it is re-established with exponential backoff the
+// next time a session is needed. Keepalives are sent periodically so that
+// dead connections are noticed (and closed) between commands rather than
+// part way through one, until the connection is closed.
+type SshConnection struct {
+	dial func(ctx context.Context) (*goph.Client, error)
+
+	mu     sync.Mutex
+	client *goph.Client
+	// set while a new client is being dialed, and closed once it has been
+	dialing chan struct{}
+
+	sessions chan struct{}
+
+	// closed by Close, stopping the keepalives
+	done      chan struct{}
+	closeOnce sync.Once
+	// anything else to close along with the connection, e.g. the ssh-agent
+	// connection its auth uses
+	closers []io.Closer
+
+	reconnectAttempts int
+	reconnectBackoff  time.Duration
+	keepaliveInterval time.Duration
+}
+
+var errSshConnectionClosed = errors.New("the SSH connection has been closed")
+
+type SshConnectionOpts struct {
+	MaxSessions       int
+	ReconnectAttempts int
+	KeepaliveInterval time.Duration
+}
+
+func NewSshConnection(dial func(ctx context.Context) (*goph.Client, error), opts SshConnectionOpts) *SshConnection {
+	if opts.MaxSessions < 1 {
+		opts.MaxSessions = 1
+	}
+	if opts.ReconnectAttempts < 1 {
+		opts.ReconnectAttempts = 1
+	}
+
+	conn := &SshConnection{
+		dial:              dial,
+		sessions:          make(chan struct{}, opts.MaxSessions),
+		done:              make(chan struct{}),
+		reconnectAttempts: opts.ReconnectAttempts,
+		reconnectBackoff:  time.Second,
+		keepaliveInterval: opts.KeepaliveInterval,
+	}
+
+	if conn.keepaliveInterval > 0 {
+		go conn.keepalive()
+	}
+
+	return conn
+}
+
+// Run the command in a new session, returning its stdout and stderr. stdin, if
+// given, is streamed to the command.
+//
+// If the context is cancelled (e.g. the operation timed out, or terraform was
+// interrupted) before the command finishes then the session is closed, which
+// in turn terminates the command on the host.
+func (c *SshConnection) Run(ctx context.Context, cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	select {
+	case c.sessions <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	defer func() { <-c.sessions }()
+
+	sess, err := c.newSession(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sess.Close()
+
+	var stdout, stderr bytes.Buffer
+	sess.Stdin = stdin
+	sess.Stdout = &stdout
+	sess.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.Run(cmd)
+	}()
+
+	select {
+	case err := <-done:
+		return stdout.Bytes(), stderr.Bytes(), err
+	case <-ctx.Done():
+		log.Printf("[WARN] SSH: %v, closing session", ctx.Err())
+		sess.Signal(ssh.SIGTERM)
+		sess.Close()
+		<-done
+		return stdout.Bytes(), stderr.Bytes(), ctx.Err()
+	}
+}
+
+// Open a new session, reconnecting if the existing connection can't give us
+// one. Commands are only ever retried here, before they've been sent, as we
+// can't know whether a command that was interrupted part way through had any
+// effect on the host.
+func (c *SshConnection) newSession(ctx context.Context) (*ssh.Session, error) {
+	client, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := client.NewSession()
+	if err == nil {
+		return sess, nil
+	}
+
+	log.Printf("[WARN] SSH: could not open session (%v), reconnecting", err)
+	c.reset(client)
+
+	client, err = c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.NewSession()
+}
+
+// Return the current client, dialing a new one if there isn't one. The lock
+// isn't held while dialing, which can take a while against an unresponsive
+// host: callers that arrive in the meantime wait for that dial (or for their
+// context to be done) rather than starting their own.
+func (c *SshConnection) connect(ctx context.Context) (*goph.Client, error) {
+	for {
+		c.mu.Lock()
+
+		if c.client != nil {
+			client := c.client
+			c.mu.Unlock()
+			return client, nil
+		}
+
+		select {
+		case <-c.done:
+			c.mu.Unlock()
+			return nil, errSshConnectionClosed
+		default:
+		}
+
+		if c.dialing == nil {
+			c.dialing = make(chan struct{})
+			c.mu.Unlock()
+			break
+		}
+
+		dialing := c.dialing
+		c.mu.Unlock()
+
+		select {
+		case <-dialing:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	client, err := c.dialWithBackoff(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	close(c.dialing)
+	c.dialing = nil
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-c.done:
+		client.Close()
+		return nil, errSshConnectionClosed
+	default:
+	}
+
+	c.client = client
+	return client, nil
+}
+
+// Dial up to reconnectAttempts times, backing off exponentially between them
+func (c *SshConnection) dialWithBackoff(ctx context.Context) (*goph.Client, error) {
+	var err error
+	backoff := c.reconnectBackoff
+
+	for attempt := 1; attempt <= c.reconnectAttempts; attempt++ {
+		var client *goph.Client
+		client, err = c.dial(ctx)
+
+		if err == nil {
+			return client, nil
+		}
+
+		log.Printf("[WARN] SSH: connection attempt %d/%d failed: %v", attempt, c.reconnectAttempts, err)
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if attempt < c.reconnectAttempts {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			backoff *= 2
+		}
+	}
+
+	return nil, fmt.Errorf("could not connect after %d attempt(s): %w", c.reconnectAttempts, err)
+}
+
+// Close the connection and stop sending keepalives. Commands can't be run once
+// it's closed.
+func (c *SshConnection) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		for _, closer := range c.closers {
+			closer.Close()
+		}
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		err = c.client.Close()
+		c.client = nil
+	}
+	return err
+}
+
+// Close the given closers along with the connection
+func (c *SshConnection) closeWith(closers ...io.Closer) {
+	c.closers = append(c.closers, closers...)
+}
+
+// Close and forget the given client, so long as it hasn't already been
+// replaced by another goroutine
+func (c *SshConnection) reset(broken *goph.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == broken {
+		c.client.Close()
+		c.client = nil
+	}
+}
+
+// Periodically check the connection is still alive, dropping it if not
+func (c *SshConnection) keepalive() {
+	ticker := time.NewTicker(c.keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+
+		c.mu.Lock()
+		client := c.client
+		c.mu.Unlock()
+
+		if client == nil {
+			continue
+		}
+
+		// SendRequest blocks until the server replies, which it never will if
+		// the connection has silently dropped - so don't wait on it forever.
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+
+		select {
+		case err := <-replied:
+			if err != nil {
+				log.Printf("[WARN] SSH: keepalive failed (%v), dropping connection", err)
+				c.reset(client)
+			}
+		case <-time.After(c.keepaliveInterval):
+			log.Printf("[WARN] SSH: keepalive timed out, dropping connection")
+			c.reset(client)
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Connect to the SSH server described by config, with the TCP connection made
+// by dialer. Both connecting and the SSH handshake are abandoned if the context
+// is done, or if they take longer than config.Timeout.
+func sshDial(ctx context.Context, dialer func(ctx context.Context, network, addr string) (net.Conn, error), config *goph.Config) (*goph.Client, error) {
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	addr := net.JoinHostPort(config.Addr, fmt.Sprint(config.Port))
+
+	conn, err := dialer(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshake doesn't take a context, so abandon it by closing the
+	// connection out from under it
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            config.Auth,
+		HostKeyCallback: config.Callback,
+		BannerCallback:  config.BannerCallback,
+	})
+
+	if !stop() {
+		if err == nil {
+			clientConn.Close()
+		}
+		return nil, fmt.Errorf("SSH handshake with %s abandoned: %w", addr, ctx.Err())
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &goph.Client{Client: ssh.NewClient(clientConn, chans, reqs), Config: config}, nil
+}
+
+// Connect to the target host through an SSH bastion (jump host). The returned
+// client behaves exactly as one from sshDial would, with the connection to the
+// bastion being closed along with it.
+func dialViaBastion(ctx context.Context, bastion *goph.Config, target *goph.Config) (*goph.Client, error) {
+	bastionClient, err := sshDial(ctx, (&net.Dialer{}).DialContext, bastion)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to bastion %s: %w", bastion.Addr, err)
+	}
+
+	client, err := sshDial(ctx, bastionClient.DialContext, target)
+	if err != nil {
+		bastionClient.Close()
+		return nil, fmt.Errorf("could not connect to %s via bastion %s: %w", target.Addr, bastion.Addr, err)
+	}
+
+	go func() {
+		client.Wait()
+		bastionClient.Close()
+	}()
+
+	return client, nil
+}
@@ -0,0 +1,406 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+// Start a fake dokku server and a connection to it that counts its dials
+func newCountingSshConnection(t *testing.T, reconnectAttempts int) (*fakeDokkuServer, *SshConnection, *int32) {
+	t.Helper()
+
+	server, err := startFakeDokkuServer(newFakeDokku(fakeDokkuVersion))
+	if err != nil {
+		t.Fatalf("could not start fake dokku server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	dial := fakeDokkuDial(t, server)
+	var dials int32
+	conn := NewSshConnection(func(ctx context.Context) (*goph.Client, error) {
+		atomic.AddInt32(&dials, 1)
+		return dial(ctx)
+	}, SshConnectionOpts{MaxSessions: 1, ReconnectAttempts: reconnectAttempts})
+	conn.reconnectBackoff = time.Millisecond
+	t.Cleanup(func() { conn.Close() })
+
+	return server, conn, &dials
+}
+
+func TestSshConnectionReconnect(t *testing.T) {
+	server, conn, dials := newCountingSshConnection(t, 3)
+	ctx := context.Background()
+
+	stdout, _, err := conn.Run(ctx, "version", nil)
+	if err != nil {
+		t.Fatalf("could not run command: %v", err)
+	}
+	if !strings.Contains(string(stdout), fakeDokkuVersion) {
+		t.Errorf("unexpected output %q", stdout)
+	}
+	if n := atomic.LoadInt32(dials); n != 1 {
+		t.Fatalf("expected 1 dial, got %d", n)
+	}
+
+	server.DropConnections()
+
+	stdout, _, err = conn.Run(ctx, "version", nil)
+	if err != nil {
+		t.Fatalf("could not run command after the connection dropped: %v", err)
+	}
+	if !strings.Contains(string(stdout), fakeDokkuVersion) {
+		t.Errorf("unexpected output %q", stdout)
+	}
+	if n := atomic.LoadInt32(dials); n != 2 {
+		t.Errorf("expected a redial after the connection dropped, got %d dial(s)", n)
+	}
+}
+
+func TestSshConnectionReconnectAttempts(t *testing.T) {
+	server, conn, dials := newCountingSshConnection(t, 3)
+	ctx := context.Background()
+
+	if _, _, err := conn.Run(ctx, "version", nil); err != nil {
+		t.Fatalf("could not run command: %v", err)
+	}
+
+	server.Close()
+	server.DropConnections()
+
+	_, _, err := conn.Run(ctx, "version", nil)
+	if err == nil {
+		t.Fatal("expected the command to fail once the host is gone")
+	}
+	if !strings.Contains(err.Error(), "after 3 attempt(s)") {
+		t.Errorf("unexpected error %v", err)
+	}
+	// The first dial plus the 3 attempts to reconnect
+	if n := atomic.LoadInt32(dials); n != 4 {
+		t.Errorf("expected 4 dials, got %d", n)
+	}
+}
+
+func TestSshConnectionClose(t *testing.T) {
+	_, conn, dials := newCountingSshConnection(t, 3)
+	agentConn, agentServer := net.Pipe()
+	defer agentServer.Close()
+	conn.closeWith(agentConn)
+	conn.keepaliveInterval = time.Millisecond
+	stopped := make(chan struct{})
+	go func() {
+		conn.keepalive()
+		close(stopped)
+	}()
+	ctx := context.Background()
+
+	if _, _, err := conn.Run(ctx, "version", nil); err != nil {
+		t.Fatalf("could not run command: %v", err)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("expected the keepalives to stop once the connection is closed")
+	}
+
+	// Along with anything its auth was using
+	if _, err := agentConn.Write([]byte{0}); err == nil {
+		t.Errorf("expected the connections closed along with it to be closed")
+	}
+
+	// Closing twice is harmless
+	if err := conn.Close(); err != nil {
+		t.Fatalf("second close failed: %v", err)
+	}
+
+	if _, _, err := conn.Run(ctx, "version", nil); err == nil {
+		t.Errorf("expected commands to fail once the connection is closed")
+	}
+	if n := atomic.LoadInt32(dials); n != 1 {
+		t.Errorf("expected no redial once the connection is closed, got %d dial(s)", n)
+	}
+}
+
+// Listen for connections that are accepted but never answered, as a blackholed
+// host's are
+func testSilentListener(t *testing.T) net.Listener {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	return listener
+}
+
+func TestSshDialTimeout(t *testing.T) {
+	listener := testSilentListener(t)
+	addr := listener.Addr().(*net.TCPAddr)
+
+	config := &goph.Config{
+		User:     "dokku",
+		Addr:     addr.IP.String(),
+		Port:     uint(addr.Port),
+		Callback: ssh.InsecureIgnoreHostKey(),
+		Timeout:  50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	_, err := sshDial(context.Background(), (&net.Dialer{}).DialContext, config)
+	if err == nil {
+		t.Fatal("expected the handshake with a silent host to time out")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the dial to give up after its timeout, took %v", elapsed)
+	}
+}
+
+func TestSshConnectionDialCancelled(t *testing.T) {
+	listener := testSilentListener(t)
+	addr := listener.Addr().(*net.TCPAddr)
+
+	config := &goph.Config{
+		User:     "dokku",
+		Addr:     addr.IP.String(),
+		Port:     uint(addr.Port),
+		Callback: ssh.InsecureIgnoreHostKey(),
+	}
+	conn := NewSshConnection(func(ctx context.Context) (*goph.Client, error) {
+		return sshDial(ctx, (&net.Dialer{}).DialContext, config)
+	}, SshConnectionOpts{MaxSessions: 2, ReconnectAttempts: 1})
+	t.Cleanup(func() { conn.Close() })
+
+	// One command is stuck dialing the silent host...
+	ctx, cancel := context.WithCancel(context.Background())
+	stuck := make(chan error, 1)
+	go func() {
+		_, _, err := conn.Run(ctx, "version", nil)
+		stuck <- err
+	}()
+
+	// ...which doesn't hold up another whose context is done
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer waitCancel()
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := conn.Run(waitCtx, "version", nil)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a deadline exceeded error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the waiting command to give up when its context was done")
+	}
+
+	// and the stuck dial is abandoned once its own context is cancelled
+	cancel()
+	select {
+	case err := <-stuck:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a cancelled error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the dial to be abandoned when its context was cancelled")
+	}
+}
+
+// Provider config for connecting to the target through the bastion, pinning
+// the given host keys
+func testBastionProviderConfig(t *testing.T, target *fakeDokkuServer, targetHostKey ssh.PublicKey, bastion *fakeDokkuServer, bastionHostKey ssh.PublicKey) *schema.ResourceData {
+	t.Helper()
+
+	_, key := testUserKey(t)
+
+	return schema.TestResourceDataRaw(t, Provider().Schema, map[string]interface{}{
+		"ssh_host":               target.Host,
+		"ssh_port":               target.Port,
+		"ssh_user":               "dokku",
+		"ssh_cert":               key,
+		"host_key":               string(ssh.MarshalAuthorizedKey(targetHostKey)),
+		"ssh_reconnect_attempts": 1,
+		"ssh_keepalive_interval": 0,
+		"bastion": []interface{}{
+			map[string]interface{}{
+				"ssh_host": bastion.Host,
+				"ssh_port": bastion.Port,
+				"ssh_user": "jump",
+				"host_key": string(ssh.MarshalAuthorizedKey(bastionHostKey)),
+			},
+		},
+	})
+}
+
+func TestConfigureSshConnectionBastion(t *testing.T) {
+	target, err := startFakeDokkuServer(newFakeDokku(fakeDokkuVersion))
+	if err != nil {
+		t.Fatalf("could not start fake dokku server: %v", err)
+	}
+	t.Cleanup(func() { target.Close() })
+
+	bastion, err := startFakeDokkuServer(newFakeDokku(fakeDokkuVersion))
+	if err != nil {
+		t.Fatalf("could not start fake bastion: %v", err)
+	}
+	t.Cleanup(func() { bastion.Close() })
+
+	ctx := context.Background()
+
+	conn, diags := configureSshConnection(ctx, testBastionProviderConfig(t, target, target.HostKey, bastion, bastion.HostKey))
+	if diags.HasError() {
+		t.Fatalf("could not connect via the bastion: %v", diags)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if _, _, err := conn.Run(ctx, "apps:create test-app", nil); err != nil {
+		t.Fatalf("could not run command: %v", err)
+	}
+
+	if _, ok := target.apps["test-app"]; !ok {
+		t.Errorf("expected the command to run on the target")
+	}
+	if _, ok := bastion.apps["test-app"]; ok {
+		t.Errorf("expected the command not to run on the bastion")
+	}
+	if bastion.Forwards() != 1 {
+		t.Errorf("expected the connection to be forwarded through the bastion once, got %d", bastion.Forwards())
+	}
+
+	otherKey := testHostKey(t)
+
+	cases := []struct {
+		name           string
+		targetHostKey  ssh.PublicKey
+		bastionHostKey ssh.PublicKey
+		err            string
+	}{
+		{"bastion host key mismatch", target.HostKey, otherKey, "could not connect to bastion"},
+		{"target host key mismatch", otherKey, bastion.HostKey, "via bastion"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, diags := configureSshConnection(ctx, testBastionProviderConfig(t, target, c.targetHostKey, bastion, c.bastionHostKey))
+			if !diags.HasError() {
+				t.Fatal("expected the connection to fail")
+			}
+			if summary := diags[0].Summary; !strings.Contains(summary, c.err) || !strings.Contains(summary, "host key mismatch") {
+				t.Errorf("expected a host key mismatch error containing %q, got %s", c.err, summary)
+			}
+		})
+	}
+
+	if bastion.Forwards() != 2 {
+		t.Errorf("expected only the connection with the target's key mismatched to be forwarded, got %d forwards", bastion.Forwards())
+	}
+}
+
+func TestSshConnectionRunCancelled(t *testing.T) {
+	server, conn, _ := newCountingSshConnection(t, 1)
+	server.hold = make(chan struct{})
+	release := sync.OnceFunc(func() { close(server.hold) })
+	t.Cleanup(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	running := make(chan error, 1)
+	go func() {
+		_, _, err := conn.Run(ctx, "apps:create test-app", nil)
+		running <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&server.held) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&server.held) != 1 {
+		t.Fatal("expected the command to be running on the host")
+	}
+
+	// With the only session slot taken, another command queues for it
+	queuedCtx, queuedCancel := context.WithCancel(context.Background())
+	queued := make(chan error, 1)
+	go func() {
+		_, _, err := conn.Run(queuedCtx, "apps:create other-app", nil)
+		queued <- err
+	}()
+
+	queuedCancel()
+	select {
+	case err := <-queued:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the queued command to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the queued command to give up its wait for a session")
+	}
+
+	// Cancelling the running command closes its session, abandoning it on
+	// the host
+	cancel()
+	select {
+	case err := <-running:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the running command to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the running command to be aborted")
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for server.Abandoned() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := server.Abandoned(); n != 1 {
+		t.Errorf("expected the host to see the command abandoned, got %d", n)
+	}
+
+	// The session slot is freed for the next command
+	release()
+	if _, _, err := conn.Run(context.Background(), "version", nil); err != nil {
+		t.Errorf("expected the next command to run, got %v", err)
+	}
+}
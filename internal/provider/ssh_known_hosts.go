@@ -0,0 +1,215 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Ways of verifying the host key of the server being connected to. Any of
+// HostKey, HostKeyFingerprint or KnownHosts are checked strictly and take
+// precedence over the ~/.ssh/known_hosts based check.
+type hostKeyOpts struct {
+	SkipKnownHostsCheck bool
+	HostKey             string
+	HostKeyFingerprint  string
+	KnownHosts          string
+}
+
+// Build the callback to verify the host key against. Unlike knownHostsCallback
+// the pinned keys are never written anywhere, so are safe to use on ephemeral
+// runners & Terraform Cloud.
+func hostKeyCallback(opts hostKeyOpts) (ssh.HostKeyCallback, error) {
+	pinned := opts.HostKey != "" || opts.HostKeyFingerprint != "" || opts.KnownHosts != ""
+
+	if pinned && opts.SkipKnownHostsCheck {
+		log.Printf("[WARN] skip_known_hosts_check is ignored as a host key has been pinned")
+	}
+
+	switch {
+	case opts.HostKey != "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(opts.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse host_key: %v", err)
+		}
+		return ssh.FixedHostKey(key), nil
+	case opts.HostKeyFingerprint != "":
+		return fingerprintCallback(opts.HostKeyFingerprint), nil
+	case opts.KnownHosts != "":
+		return inlineKnownHostsCallback(opts.KnownHosts)
+	}
+
+	return knownHostsCallback(opts.SkipKnownHostsCheck), nil
+}
+
+// Check known hosts
+// https://github.com/melbahja/goph/blob/6258fe9f54bb1f738543020ade7ab22c1dd233d7/examples/goph/main.go#L75-L109
+func knownHostsCallback(skipKnownHostsCheck bool) ssh.HostKeyCallback {
+	return func(host string, remote net.Addr, key ssh.PublicKey) error {
+		// See https://github.com/aaronstillwell/terraform-provider-dokku/issues/15 - this option
+		// has been implemented to support using the provider on Terraform Cloud
+		if !skipKnownHostsCheck {
+			hostFound, err := goph.CheckKnownHost(host, remote, key, "")
+
+			// Host in known hosts but key mismatch
+			if hostFound && err != nil {
+				return err
+			}
+
+			// handshake because public key already exists.
+			if hostFound && err == nil {
+				return nil
+			}
+		} else {
+			log.Printf("[WARN]: skip_known_hosts_check is set to true, no key verification will be run against the SSH host %s", host)
+		}
+		return goph.AddKnownHost(host, remote, key, "")
+	}
+}
+
+// Accepts either the SHA256 fingerprint shown by modern versions of
+// ssh-keygen -lf, or the legacy MD5 one
+func fingerprintCallback(fingerprint string) ssh.HostKeyCallback {
+	fingerprint = strings.TrimSpace(fingerprint)
+
+	return func(host string, remote net.Addr, key ssh.PublicKey) error {
+		if fingerprint == ssh.FingerprintSHA256(key) {
+			return nil
+		}
+
+		if strings.TrimPrefix(fingerprint, "MD5:") == ssh.FingerprintLegacyMD5(key) {
+			return nil
+		}
+
+		return fmt.Errorf("host key fingerprint for %s is %s, expected %s", host, ssh.FingerprintSHA256(key), fingerprint)
+	}
+}
+
+type knownHostsEntry struct {
+	marker string
+	hosts  []string
+	key    ssh.PublicKey
+}
+
+// Verify host keys against the contents of a known_hosts file given inline.
+// Hosts that aren't listed are rejected rather than added.
+func inlineKnownHostsCallback(knownHosts string) (ssh.HostKeyCallback, error) {
+	var entries []knownHostsEntry
+
+	rest := []byte(knownHosts)
+	for {
+		marker, hosts, key, _, next, err := ssh.ParseKnownHosts(rest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse known_hosts: %v", err)
+		}
+		rest = next
+
+		if marker == "cert-authority" {
+			log.Printf("[WARN] @cert-authority entries in known_hosts are not supported, skipping")
+			continue
+		}
+
+		entries = append(entries, knownHostsEntry{marker: marker, hosts: hosts, key: key})
+	}
+
+	return func(host string, remote net.Addr, key ssh.PublicKey) error {
+		addrs := []string{knownhosts.Normalize(host)}
+		if tcpAddr, ok := remote.(*net.TCPAddr); ok {
+			addrs = append(addrs, knownhosts.Normalize(tcpAddr.String()))
+		}
+
+		hostKnown := false
+		for _, entry := range entries {
+			if !knownHostsEntryMatches(entry.hosts, addrs) {
+				continue
+			}
+
+			keyMatches := bytes.Equal(entry.key.Marshal(), key.Marshal())
+
+			if entry.marker == "revoked" {
+				if keyMatches {
+					return fmt.Errorf("host key for %s has been revoked", host)
+				}
+				continue
+			}
+
+			hostKnown = true
+			if keyMatches {
+				return nil
+			}
+		}
+
+		if hostKnown {
+			return fmt.Errorf("host key mismatch for %s, got %s", host, ssh.FingerprintSHA256(key))
+		}
+
+		return fmt.Errorf("host %s is not present in known_hosts", host)
+	}, nil
+}
+
+// Whether any of the addresses match the host patterns from a known_hosts line,
+// taking into account negated (!), wildcard (*, ?) & hashed (|1|) patterns
+func knownHostsEntryMatches(patterns []string, addrs []string) bool {
+	matched := false
+
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		for _, addr := range addrs {
+			if !knownHostsPatternMatches(pattern, addr) {
+				continue
+			}
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+func knownHostsPatternMatches(pattern string, addr string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[len("|1|"):], "|")
+		if len(parts) != 2 {
+			return false
+		}
+
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(addr))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+
+	// Only * and ? are wildcards in known_hosts, square brackets denote a port
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\*`, ".*")
+	re = strings.ReplaceAll(re, `\?`, ".")
+
+	matched, err := regexp.MatchString("^"+re+"$", addr)
+	return err == nil && matched
+}
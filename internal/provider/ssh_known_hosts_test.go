@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestInlineKnownHostsCallback(t *testing.T) {
+	hostKey := testHostKey(t)
+	otherKey := testHostKey(t)
+
+	line := func(hosts string, key ssh.PublicKey) string {
+		return fmt.Sprintf("%s %s", hosts, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+	}
+
+	cases := []struct {
+		name       string
+		knownHosts []string
+		host       string
+		remote     string
+		key        ssh.PublicKey
+		// a substring of the expected error, empty when the key is accepted
+		err string
+	}{
+		{
+			name:       "match",
+			knownHosts: []string{line("dokku.example.com", hostKey)},
+			host:       "dokku.example.com:22",
+			key:        hostKey,
+		},
+		{
+			name:       "key mismatch",
+			knownHosts: []string{line("dokku.example.com", hostKey)},
+			host:       "dokku.example.com:22",
+			key:        otherKey,
+			err:        "host key mismatch",
+		},
+		{
+			name:       "unknown host",
+			knownHosts: []string{line("dokku.example.com", hostKey)},
+			host:       "other.example.com:22",
+			key:        hostKey,
+			err:        "not present in known_hosts",
+		},
+		{
+			name:       "matched by remote address",
+			knownHosts: []string{line("10.0.0.1", hostKey)},
+			host:       "dokku.example.com:22",
+			remote:     "10.0.0.1:22",
+			key:        hostKey,
+		},
+		{
+			name:       "hashed",
+			knownHosts: []string{line(knownhosts.HashHostname("dokku.example.com"), hostKey)},
+			host:       "dokku.example.com:22",
+			key:        hostKey,
+		},
+		{
+			name:       "hashed for another host",
+			knownHosts: []string{line(knownhosts.HashHostname("other.example.com"), hostKey)},
+			host:       "dokku.example.com:22",
+			key:        hostKey,
+			err:        "not present in known_hosts",
+		},
+		{
+			name:       "wildcard",
+			knownHosts: []string{line("*.example.com", hostKey)},
+			host:       "dokku.example.com:22",
+			key:        hostKey,
+		},
+		{
+			name:       "negated",
+			knownHosts: []string{line("*.example.com,!dokku.example.com", hostKey)},
+			host:       "dokku.example.com:22",
+			key:        hostKey,
+			err:        "not present in known_hosts",
+		},
+		{
+			name:       "not negated",
+			knownHosts: []string{line("*.example.com,!dokku.example.com", hostKey)},
+			host:       "other.example.com:22",
+			key:        hostKey,
+		},
+		{
+			name: "revoked",
+			knownHosts: []string{
+				"@revoked " + line("*", hostKey),
+				line("dokku.example.com", hostKey),
+			},
+			host: "dokku.example.com:22",
+			key:  hostKey,
+			err:  "has been revoked",
+		},
+		{
+			name: "another key revoked",
+			knownHosts: []string{
+				"@revoked " + line("*", otherKey),
+				line("dokku.example.com", hostKey),
+			},
+			host: "dokku.example.com:22",
+			key:  hostKey,
+		},
+		{
+			name:       "non-22 port",
+			knownHosts: []string{line("[dokku.example.com]:2222", hostKey)},
+			host:       "dokku.example.com:2222",
+			key:        hostKey,
+		},
+		{
+			name:       "non-22 port on 22",
+			knownHosts: []string{line("[dokku.example.com]:2222", hostKey)},
+			host:       "dokku.example.com:22",
+			key:        hostKey,
+			err:        "not present in known_hosts",
+		},
+		{
+			name:       "22 on a non-22 port",
+			knownHosts: []string{line("dokku.example.com", hostKey)},
+			host:       "dokku.example.com:2222",
+			key:        hostKey,
+			err:        "not present in known_hosts",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			callback, err := inlineKnownHostsCallback(strings.Join(c.knownHosts, "\n"))
+			if err != nil {
+				t.Fatalf("could not parse known_hosts: %v", err)
+			}
+
+			remote := c.remote
+			if remote == "" {
+				remote = "192.0.2.1:22"
+			}
+			addr, err := net.ResolveTCPAddr("tcp", remote)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = callback(c.host, addr, c.key)
+			if c.err == "" {
+				if err != nil {
+					t.Errorf("expected the key to be accepted, got %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected an error containing %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestFingerprintCallback(t *testing.T) {
+	hostKey := testHostKey(t)
+	otherKey := testHostKey(t)
+
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}
+
+	cases := []struct {
+		name        string
+		fingerprint string
+		accepted    bool
+	}{
+		{"sha256", ssh.FingerprintSHA256(hostKey), true},
+		{"sha256 with whitespace", ssh.FingerprintSHA256(hostKey) + "\n", true},
+		{"md5", "MD5:" + ssh.FingerprintLegacyMD5(hostKey), true},
+		{"md5 without prefix", ssh.FingerprintLegacyMD5(hostKey), true},
+		{"sha256 mismatch", ssh.FingerprintSHA256(otherKey), false},
+		{"md5 mismatch", "MD5:" + ssh.FingerprintLegacyMD5(otherKey), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := fingerprintCallback(c.fingerprint)("dokku.example.com:22", addr, hostKey)
+			if c.accepted && err != nil {
+				t.Errorf("expected the key to be accepted, got %v", err)
+			}
+			if !c.accepted && err == nil {
+				t.Errorf("expected the key to be rejected")
+			}
+		})
+	}
+}
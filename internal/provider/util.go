@@ -2,12 +2,13 @@ package provider
 
 import (
 	"math/rand"
+	"sort"
 	"strings"
 )
 
 //
 func interfaceSliceToStrSlice(list []interface{}) []string {
-	slice := make([]string, len(list))
+	slice := make([]string, 0, len(list))
 
 	for _, d := range list {
 		slice = append(slice, d.(string))
@@ -93,10 +94,14 @@ func parseKeyValues(lines []string) map[string]string {
 		kp = strings.TrimSpace(kp)
 		if len(kp) > 0 {
 			parts := strings.Split(kp, ":")
+			// Skip lines that aren't key-value pairs, e.g a report's heading
+			if len(parts) < 2 {
+				continue
+			}
 			key := strings.TrimSpace(parts[0])
 
 			val := parts[1]
-			if len(parts[1]) > 1 {
+			if len(parts) > 2 {
 				val = strings.Join(parts[1:], ":")
 			}
 			val = strings.TrimSpace(val)
@@ -107,3 +112,13 @@ func parseKeyValues(lines []string) map[string]string {
 
 	return keyValues
 }
+
+// The keys of the map, sorted so that commands are run in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterfaceSliceToStrSlice(t *testing.T) {
+	cases := []struct {
+		list     []interface{}
+		expected []string
+	}{
+		{nil, []string{}},
+		{[]interface{}{}, []string{}},
+		{[]interface{}{"a", "b"}, []string{"a", "b"}},
+	}
+
+	for _, c := range cases {
+		slice := interfaceSliceToStrSlice(c.list)
+		if !reflect.DeepEqual(slice, c.expected) {
+			t.Errorf("%#v: expected %#v, got %#v", c.list, c.expected, slice)
+		}
+	}
+}
+
+func TestParseKeyValues(t *testing.T) {
+	lines := []string{
+		"=====> test-app proxy information",
+		"       Proxy enabled:       true",
+		"       Proxy port map:      http:80:5000 https:443:5000",
+		"       Proxy type:",
+		"",
+	}
+	expected := map[string]string{
+		"Proxy enabled":  "true",
+		"Proxy port map": "http:80:5000 https:443:5000",
+		"Proxy type":     "",
+	}
+
+	if keyValues := parseKeyValues(lines); !reflect.DeepEqual(keyValues, expected) {
+		t.Errorf("expected %#v, got %#v", expected, keyValues)
+	}
+}